@@ -0,0 +1,1004 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/chojs23/im-switch/imswitch"
+)
+
+// version is the release version, overridden at build time with
+// -ldflags "-X main.version=...".
+var version = "dev"
+
+// runGet implements `im-switch get`.
+func runGet(c *cli, args []string) int {
+	fs := c.flagSet(lookupCommand("get"))
+	formatValue := fs.String("format", "", formatUsage)
+	positional, code, ok := parseFlags(fs, args)
+	if !ok {
+		return code
+	}
+	if len(positional) > 0 {
+		return c.usageError("get takes no arguments")
+	}
+	format, code, ok := c.formatFlag(*formatValue)
+	if !ok {
+		return code
+	}
+
+	switcher := c.opts.switcher()
+	ctx := context.Background()
+
+	if c.opts.json || format != nil {
+		source, err := switcher.CurrentSource(ctx)
+		if err != nil {
+			return c.reportError(err)
+		}
+		if format != nil {
+			if err := format.write(c.stdout, formatData{InputSource: source, Current: true}); err != nil {
+				return c.reportError(err)
+			}
+			return exitOK
+		}
+		writeJSON(c.stdout, jsonSource{InputSource: source, Current: true})
+		return exitOK
+	}
+
+	current, err := switcher.Current(ctx)
+	if err != nil {
+		return c.reportError(err)
+	}
+	fmt.Fprintln(c.stdout, current)
+	return exitOK
+}
+
+// runSet implements `im-switch set`. Given several IDs, it switches to the
+// first one the backend lists and prints it.
+func runSet(c *cli, args []string) int {
+	fs := c.flagSet(lookupCommand("set"))
+	positional, code, ok := parseFlags(fs, args)
+	if !ok {
+		return code
+	}
+	if len(positional) == 0 {
+		return c.usageError("set requires an input source ID")
+	}
+
+	resolver, err := newResolver(c.opts.switcher())
+	if err != nil {
+		return c.reportError(err)
+	}
+	ctx := context.Background()
+	var selected string
+	if len(positional) == 1 {
+		selected, err = resolver.set(ctx, positional[0])
+	} else {
+		selected, err = resolver.setFirst(ctx, positional)
+	}
+	if err != nil {
+		return c.reportError(err)
+	}
+	// A single ID switches silently, as it always has.
+	switch {
+	case c.opts.json:
+		writeJSON(c.stdout, setResult{Selected: selected})
+	case len(positional) > 1:
+		fmt.Fprintln(c.stdout, selected)
+	}
+	return exitOK
+}
+
+// setResult reports the ID that `set` switched to.
+type setResult struct {
+	Selected string `json:"selected"`
+}
+
+// runList implements `im-switch list`.
+func runList(c *cli, args []string) int {
+	fs := c.flagSet(lookupCommand("list"))
+	long := fs.Bool("long", false, "show kind, language and name of each source")
+	formatValue := fs.String("format", "", formatUsage)
+	positional, code, ok := parseFlags(fs, args)
+	if !ok {
+		return code
+	}
+	if len(positional) > 0 {
+		return c.usageError("list takes no arguments")
+	}
+	format, code, ok := c.formatFlag(*formatValue)
+	if !ok {
+		return code
+	}
+	if format != nil && format.name == "long" {
+		*long, format = true, nil
+	}
+
+	switcher := c.opts.switcher()
+	sources, err := switcher.List(context.Background())
+	if err != nil {
+		return c.reportError(err)
+	}
+
+	switch {
+	case c.opts.json:
+		// The current source is only used to flag entries; failing to read
+		// it should not fail the listing.
+		current, _ := switcher.Current(context.Background())
+		entries := make([]jsonSource, 0, len(sources))
+		for _, source := range sources {
+			entries = append(entries, jsonSource{InputSource: source, Current: source.ID == current})
+		}
+		writeJSON(c.stdout, entries)
+	case format != nil:
+		current, _ := switcher.Current(context.Background())
+		entries := make([]formatData, 0, len(sources))
+		for _, source := range sources {
+			entries = append(entries, formatData{InputSource: source, Current: source.ID == current})
+		}
+		if err := format.write(c.stdout, entries...); err != nil {
+			return c.reportError(err)
+		}
+	case *long:
+		writeSourceTable(c.stdout, sources)
+	default:
+		for _, source := range sources {
+			fmt.Fprintln(c.stdout, source.ID)
+		}
+	}
+	return exitOK
+}
+
+// runToggle implements `im-switch toggle`. It switches to the ID after the
+// current source in args, wrapping around, or to the first ID when the current
+// source is not among them.
+func runToggle(c *cli, args []string) int {
+	fs := c.flagSet(lookupCommand("toggle"))
+	positional, code, ok := parseFlags(fs, args)
+	if !ok {
+		return code
+	}
+	if len(positional) < 2 {
+		return c.usageError("toggle requires at least two input source IDs")
+	}
+
+	switcher := c.opts.switcher()
+	ctx := context.Background()
+
+	resolver, err := newResolver(switcher)
+	if err != nil {
+		return c.reportError(err)
+	}
+	ring, err := resolver.resolveAll(ctx, positional)
+	if err != nil {
+		return c.reportError(err)
+	}
+	current, err := switcher.Current(ctx)
+	if err != nil {
+		return c.reportError(err)
+	}
+	return c.switchFrom(ctx, switcher, current, nextInRing(ring, current, false))
+}
+
+// switchResult reports the outcome of a command that changes the source.
+type switchResult struct {
+	Previous string `json:"previous"`
+	Current  string `json:"current"`
+	Changed  bool   `json:"changed"`
+}
+
+// switchFrom switches from current to next and prints the new source ID.
+func (c *cli) switchFrom(ctx context.Context, switcher *imswitch.Switcher, current, next string) int {
+	if next != current {
+		if err := switcher.Set(ctx, next); err != nil {
+			return c.reportError(err)
+		}
+	}
+
+	if c.opts.json {
+		writeJSON(c.stdout, switchResult{Previous: current, Current: next, Changed: next != current})
+	} else {
+		fmt.Fprintln(c.stdout, next)
+	}
+	return exitOK
+}
+
+// runCycle implements `im-switch cycle`. The ring comes from the arguments,
+// the config file or, failing both, the sources enabled in the input method
+// framework. List is no fallback: it may offer sources the user never set up.
+func runCycle(c *cli, args []string) int {
+	fs := c.flagSet(lookupCommand("cycle"))
+	reverse := fs.Bool("reverse", false, "switch to the previous source instead of the next one")
+	ring, code, ok := parseFlags(fs, args)
+	if !ok {
+		return code
+	}
+
+	switcher := c.opts.switcher()
+	ctx := context.Background()
+
+	resolver, err := newResolver(switcher)
+	if err != nil {
+		return c.reportError(err)
+	}
+	if len(ring) == 0 {
+		ring = resolver.cfg.Ring
+	}
+	if ring, err = resolver.resolveAll(ctx, ring); err != nil {
+		return c.reportError(err)
+	}
+	if len(ring) == 0 {
+		enabled, err := switcher.Enabled(ctx)
+		if err != nil {
+			return c.reportError(fmt.Errorf("reading the enabled input sources: %w; pass the ring as arguments or set \"ring\" in the config file", err))
+		}
+		ring = enabled
+	}
+	if len(ring) == 0 {
+		return c.reportError(errors.New(`cannot tell which input sources are enabled; pass the ring as arguments or set "ring" in the config file`))
+	}
+
+	current, err := switcher.Current(ctx)
+	if err != nil {
+		return c.reportError(err)
+	}
+	return c.switchFrom(ctx, switcher, current, nextInRing(ring, current, *reverse))
+}
+
+// nextInRing returns the entry after current in ring, or before it when
+// reverse is set, wrapping around. It returns the first entry when current is
+// not in ring.
+func nextInRing(ring []string, current string, reverse bool) string {
+	step := 1
+	if reverse {
+		step = len(ring) - 1
+	}
+	for i, id := range ring {
+		if id == current {
+			return ring[(i+step)%len(ring)]
+		}
+	}
+	return ring[0]
+}
+
+// runSave implements `im-switch save`.
+func runSave(c *cli, args []string) int {
+	fs := c.flagSet(lookupCommand("save"))
+	positional, code, ok := parseFlags(fs, args)
+	if !ok {
+		return code
+	}
+	if len(positional) != 1 || positional[0] == "" {
+		return c.usageError("save requires a slot name")
+	}
+	slot := positional[0]
+
+	store, err := openState()
+	if err != nil {
+		return c.reportError(err)
+	}
+	defer store.close()
+
+	state, err := store.load()
+	if err != nil {
+		return c.reportError(err)
+	}
+	source, err := c.opts.switcher().CurrentSource(context.Background())
+	if err != nil {
+		return c.reportError(err)
+	}
+
+	saved := savedSource{InputSource: source, SavedAt: time.Now()}
+	if state.Slots == nil {
+		state.Slots = make(map[string]savedSource)
+	}
+	state.Slots[slot] = saved
+	if err := store.store(state); err != nil {
+		return c.reportError(err)
+	}
+	c.printSaved(saved)
+	return exitOK
+}
+
+// runRestore implements `im-switch restore`.
+func runRestore(c *cli, args []string) int {
+	fs := c.flagSet(lookupCommand("restore"))
+	positional, code, ok := parseFlags(fs, args)
+	if !ok {
+		return code
+	}
+	if len(positional) != 1 || positional[0] == "" {
+		return c.usageError("restore requires a slot name")
+	}
+	slot := positional[0]
+
+	store, err := openState()
+	if err != nil {
+		return c.reportError(err)
+	}
+	defer store.close()
+
+	state, err := store.load()
+	if err != nil {
+		return c.reportError(err)
+	}
+	saved, ok := state.Slots[slot]
+	if !ok {
+		return c.reportError(fmt.Errorf("no saved slot '%s'", slot))
+	}
+
+	result, err := restoreSource(context.Background(), c.opts.switcher(), saved)
+	if err != nil {
+		return c.reportError(err)
+	}
+	c.printRestored(result)
+	return exitOK
+}
+
+// runPush implements `im-switch push`. With an ID it also switches to it, so
+// `push ID` ... `pop` brackets a temporary change.
+func runPush(c *cli, args []string) int {
+	fs := c.flagSet(lookupCommand("push"))
+	positional, code, ok := parseFlags(fs, args)
+	if !ok {
+		return code
+	}
+	if len(positional) > 1 {
+		return c.usageError("push takes at most one input source ID")
+	}
+
+	store, err := openState()
+	if err != nil {
+		return c.reportError(err)
+	}
+	defer store.close()
+
+	state, err := store.load()
+	if err != nil {
+		return c.reportError(err)
+	}
+	switcher := c.opts.switcher()
+	ctx := context.Background()
+
+	source, err := switcher.CurrentSource(ctx)
+	if err != nil {
+		return c.reportError(err)
+	}
+	saved := savedSource{InputSource: source, SavedAt: time.Now()}
+	state.push(saved)
+
+	if len(positional) == 0 {
+		if err := store.store(state); err != nil {
+			return c.reportError(err)
+		}
+		c.printSaved(saved)
+		return exitOK
+	}
+
+	resolver, err := newResolver(switcher)
+	if err != nil {
+		return c.reportError(err)
+	}
+	next, err := resolver.resolve(ctx, positional[0])
+	if err != nil {
+		return c.reportError(err)
+	}
+	if next != source.ID {
+		if err := switcher.Set(ctx, next); err != nil {
+			return c.reportError(err)
+		}
+	}
+	if err := store.store(state); err != nil {
+		// Undo the switch so that a later pop does not restore the wrong
+		// source.
+		if next != source.ID {
+			if undoErr := switcher.Set(ctx, source.ID); undoErr != nil {
+				err = fmt.Errorf("%w; switching back to %s also failed: %v", err, source.ID, undoErr)
+			}
+		}
+		return c.reportError(err)
+	}
+	c.printRestored(switchResult{Previous: source.ID, Current: next, Changed: next != source.ID})
+	return exitOK
+}
+
+// runPop implements `im-switch pop`. The entry is only removed from the stack
+// once it has been restored.
+func runPop(c *cli, args []string) int {
+	fs := c.flagSet(lookupCommand("pop"))
+	positional, code, ok := parseFlags(fs, args)
+	if !ok {
+		return code
+	}
+	if len(positional) > 0 {
+		return c.usageError("pop takes no arguments")
+	}
+
+	store, err := openState()
+	if err != nil {
+		return c.reportError(err)
+	}
+	defer store.close()
+
+	state, err := store.load()
+	if err != nil {
+		return c.reportError(err)
+	}
+	if len(state.Stack) == 0 {
+		return c.reportError(errors.New("the input source stack is empty"))
+	}
+	top := state.Stack[len(state.Stack)-1]
+
+	result, err := restoreSource(context.Background(), c.opts.switcher(), top)
+	if err != nil {
+		return c.reportError(err)
+	}
+	state.Stack = state.Stack[:len(state.Stack)-1]
+	if err := store.store(state); err != nil {
+		return c.reportError(err)
+	}
+	c.printRestored(result)
+	return exitOK
+}
+
+// restoreSource switches back to saved. It refuses sources saved with a
+// different backend, and if the switch fails part way it puts the previous
+// source back, so the source is either fully restored or left unchanged.
+func restoreSource(ctx context.Context, switcher *imswitch.Switcher, saved savedSource) (switchResult, error) {
+	backend, err := switcher.Backend(ctx)
+	if err != nil {
+		return switchResult{}, err
+	}
+	if saved.Backend != "" && saved.Backend != backend.Name() {
+		return switchResult{}, &imswitch.Error{
+			Kind:    imswitch.ErrBackendUnavailable,
+			Backend: saved.Backend,
+			Source:  saved.ID,
+			Detail:  fmt.Sprintf("saved with this backend, but %s is in use", backend.Name()),
+		}
+	}
+
+	current, err := switcher.Current(ctx)
+	if err != nil {
+		return switchResult{}, err
+	}
+	result := switchResult{Previous: current, Current: saved.ID, Changed: current != saved.ID}
+	if !result.Changed {
+		// On Windows Current reports the layout, which Set leaves alone, so
+		// the IME may still need opening or closing.
+		active, err := switcher.Active(ctx, saved.ID)
+		if err != nil {
+			return switchResult{}, err
+		}
+		if active {
+			return result, nil
+		}
+		result.Changed = true
+	}
+
+	if err := switcher.Set(ctx, saved.ID); err != nil {
+		if now, readErr := switcher.Current(ctx); readErr == nil && now != current {
+			switcher.Set(ctx, current)
+		}
+		return switchResult{}, err
+	}
+	return result, nil
+}
+
+func (c *cli) printSaved(saved savedSource) {
+	if c.opts.json {
+		writeJSON(c.stdout, saved)
+	} else {
+		fmt.Fprintln(c.stdout, saved.ID)
+	}
+}
+
+func (c *cli) printRestored(result switchResult) {
+	switch {
+	case c.opts.json:
+		writeJSON(c.stdout, result)
+	case result.Changed:
+		fmt.Fprintf(c.stdout, "%s -> %s\n", result.Previous, result.Current)
+	default:
+		fmt.Fprintf(c.stdout, "%s (unchanged)\n", result.Current)
+	}
+}
+
+// runExec implements `im-switch exec`. It runs a command under the given
+// input source and switches back to the original source once it exits.
+func runExec(c *cli, args []string) int {
+	fs := c.flagSet(lookupCommand("exec"))
+	input := fs.String("input", "", "input source `id` to use while the command runs")
+	// Flags are only parsed up to the command so that its own flags are
+	// passed through untouched.
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	argv := fs.Args()
+	switch {
+	case *input == "":
+		return c.usageError("exec requires --input")
+	case len(argv) == 0:
+		return c.usageError("exec requires a command to run")
+	}
+
+	switcher := c.opts.switcher()
+	ctx := context.Background()
+
+	resolver, err := newResolver(switcher)
+	if err != nil {
+		return c.reportError(err)
+	}
+	if *input, err = resolver.resolve(ctx, *input); err != nil {
+		return c.reportError(err)
+	}
+	original, err := switcher.Current(ctx)
+	if err != nil {
+		return c.reportError(err)
+	}
+	if *input != original {
+		if err := switcher.Set(ctx, *input); err != nil {
+			return c.reportError(err)
+		}
+	}
+
+	code := c.runChild(argv)
+
+	if *input != original {
+		if err := switcher.Set(ctx, original); err != nil {
+			fmt.Fprintf(c.stderr, "Error: failed to restore input source '%s': %v\n", original, err)
+		}
+	}
+	return code
+}
+
+// runChild runs argv with inherited stdio, forwarding signals meant for
+// im-switch to it while it runs, and returns its exit code. Following shell convention, a command that
+// is not found exits 127, one that cannot be started exits 126, and one killed
+// by a signal exits 128 plus the signal number.
+func (c *cli) runChild(argv []string) int {
+	cmd := exec.Command(argv[0], argv[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = c.stdout
+	cmd.Stderr = c.stderr
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, append(forwardedSignals, caughtSignals...)...)
+	defer signal.Stop(signals)
+
+	if err := cmd.Start(); err != nil {
+		fmt.Fprintf(c.stderr, "Error: %v\n", err)
+		if errors.Is(err, exec.ErrNotFound) || errors.Is(err, os.ErrNotExist) {
+			return 127
+		}
+		return 126
+	}
+
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case sig := <-signals:
+				if slices.Contains(forwardedSignals, sig) {
+					cmd.Process.Signal(sig)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	cmd.Wait()
+	close(done)
+
+	if status, ok := cmd.ProcessState.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+	return cmd.ProcessState.ExitCode()
+}
+
+// runWatch implements `im-switch watch`. It prints the current source, then
+// a line for every change until interrupted.
+func runWatch(c *cli, args []string) int {
+	fs := c.flagSet(lookupCommand("watch"))
+	interval := fs.Duration("interval", imswitch.DefaultPollInterval, "how often to poll backends that do not report changes")
+	count := fs.Int("count", 0, "exit after printing `n` sources (0 means no limit)")
+	formatValue := fs.String("format", "", formatUsage)
+	positional, code, ok := parseFlags(fs, args)
+	if !ok {
+		return code
+	}
+	if len(positional) > 0 {
+		return c.usageError("watch takes no arguments")
+	}
+	format, code, ok := c.formatFlag(*formatValue)
+	if !ok {
+		return code
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	encoder := json.NewEncoder(c.stdout)
+	encoder.SetEscapeHTML(false)
+	printed := 0
+	var formatErr error
+	// Keep watching while the daemon restarts, but say why nothing changes.
+	switcher := c.opts.newSwitcher(imswitch.WithErrorLog(func(err error) {
+		fmt.Fprintf(c.stderr, "Warning: %v\n", err)
+	}))
+	err := switcher.Watch(ctx, *interval, func(source imswitch.InputSource) bool {
+		switch {
+		case c.opts.json:
+			encoder.Encode(watchEvent{InputSource: source, Time: time.Now()})
+		case format != nil:
+			if formatErr = format.write(c.stdout, formatData{InputSource: source, Current: true, Time: time.Now()}); formatErr != nil {
+				return false
+			}
+		default:
+			fmt.Fprintln(c.stdout, source.ID)
+		}
+		printed++
+		return *count == 0 || printed < *count
+	})
+	if formatErr != nil {
+		return c.reportError(formatErr)
+	}
+	if err != nil && ctx.Err() == nil {
+		return c.reportError(err)
+	}
+	return exitOK
+}
+
+// watchEvent is one line of `watch --json` output.
+type watchEvent struct {
+	imswitch.InputSource
+	Time time.Time `json:"time"`
+}
+
+// defaultWaitTimeout bounds `wait-for` when --timeout is not given.
+const defaultWaitTimeout = 5 * time.Second
+
+// runWaitFor implements `im-switch wait-for`. It exits successfully once the
+// source is active and with exitTimeout when --timeout passes first.
+func runWaitFor(c *cli, args []string) int {
+	fs := c.flagSet(lookupCommand("wait-for"))
+	interval := fs.Duration("interval", imswitch.DefaultPollInterval, "how often to poll backends that do not report changes")
+	positional, code, ok := parseFlags(fs, args)
+	if !ok {
+		return code
+	}
+	if len(positional) != 1 {
+		return c.usageError("wait-for requires an input source ID")
+	}
+
+	// --timeout bounds the whole wait here rather than each backend call.
+	timeout := defaultWaitTimeout
+	if c.opts.timeoutSet {
+		timeout = c.opts.timeout
+	}
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	opts := c.opts
+	opts.timeout = 0
+	switcher := opts.switcher()
+	resolver, err := newResolver(switcher)
+	if err != nil {
+		return c.reportError(err)
+	}
+	target, err := resolver.resolve(ctx, positional[0])
+	if err != nil {
+		return c.reportError(err)
+	}
+	last, err := switcher.WaitFor(ctx, target, *interval)
+	switch {
+	case err == nil:
+		if c.opts.json {
+			source, err := switcher.CurrentSource(ctx)
+			if err != nil {
+				return c.reportError(err)
+			}
+			writeJSON(c.stdout, jsonSource{InputSource: source, Current: true})
+		}
+		return exitOK
+	case ctx.Err() != nil:
+		detail := fmt.Sprintf("not active after %s", timeout)
+		if last != "" {
+			detail += fmt.Sprintf(" (current: %s)", last)
+		}
+		timeoutErr := &imswitch.Error{Kind: imswitch.ErrTimeout, Source: target, Detail: detail}
+		// The backend was resolved before the wait began, so ctx is not needed.
+		if backend, err := switcher.Backend(context.Background()); err == nil {
+			timeoutErr.Backend = backend.Name()
+		}
+		return c.reportError(timeoutErr)
+	default:
+		return c.reportError(err)
+	}
+}
+
+// runDetect implements `im-switch detect`.
+func runDetect(c *cli, args []string) int {
+	fs := c.flagSet(lookupCommand("detect"))
+	explain := fs.Bool("explain", false, "show every probe and why other backends were rejected")
+	positional, code, ok := parseFlags(fs, args)
+	if !ok {
+		return code
+	}
+	if len(positional) > 0 {
+		return c.usageError("detect takes no arguments")
+	}
+
+	report, err := c.opts.switcher().Explain(context.Background())
+	if err != nil {
+		return c.reportError(err)
+	}
+
+	switch {
+	case c.opts.json:
+		writeJSON(c.stdout, report)
+	case *explain:
+		writeDetectionReport(c.stdout, report)
+	case report.Selected != "":
+		fmt.Fprintln(c.stdout, report.Selected)
+	}
+
+	if report.Selected == "" {
+		if !c.opts.json && !*explain {
+			c.printNoBackendError()
+		}
+		return exitBackendUnavailable
+	}
+	return exitOK
+}
+
+func writeDetectionReport(w io.Writer, r imswitch.DetectionReport) {
+	if r.Override != "" {
+		fmt.Fprintf(w, "Override: %s (detection bypassed)\n", r.Override)
+	}
+	for _, probe := range r.Probes {
+		fmt.Fprintf(w, "Probe %s:\n", probe.Name)
+		for _, observation := range probe.Observations {
+			fmt.Fprintf(w, "  %s\n", observation)
+		}
+		if probe.Result != "" {
+			fmt.Fprintf(w, "  => %s\n", probe.Result)
+		}
+	}
+	if r.Selected != "" {
+		fmt.Fprintf(w, "Selected: %s\n", r.Selected)
+	} else {
+		fmt.Fprintf(w, "Selected: none\n")
+	}
+	for _, rejection := range r.Rejected {
+		fmt.Fprintf(w, "Rejected: %s (%s)\n", rejection.Backend, rejection.Reason)
+	}
+}
+
+// runDoctor implements `im-switch doctor`. It exits with exitFailure when a
+// check fails; warnings alone do not fail it.
+func runDoctor(c *cli, args []string) int {
+	fs := c.flagSet(lookupCommand("doctor"))
+	defaultSource := fs.String("default", "", "input source `id` the editor switches to, checked against the list (default from the config file)")
+	positional, code, ok := parseFlags(fs, args)
+	if !ok {
+		return code
+	}
+	if len(positional) > 0 {
+		return c.usageError("doctor takes no arguments")
+	}
+
+	if *defaultSource == "" {
+		cfg, err := loadConfig()
+		if err != nil {
+			return c.reportError(err)
+		}
+		*defaultSource = cfg.Default
+	}
+
+	checks := c.opts.switcher().Diagnose(context.Background(), *defaultSource)
+	healthy := true
+	for _, check := range checks {
+		if check.Status == imswitch.CheckFail {
+			healthy = false
+		}
+	}
+
+	if c.opts.json {
+		writeJSON(c.stdout, struct {
+			OK     bool             `json:"ok"`
+			Checks []imswitch.Check `json:"checks"`
+		}{healthy, checks})
+	} else {
+		writeChecks(c.stdout, checks)
+	}
+	if !healthy {
+		return exitFailure
+	}
+	return exitOK
+}
+
+// writeChecks prints one line per check, marked pass, warn or fail, followed
+// by the advice for anything that did not pass.
+func writeChecks(w io.Writer, checks []imswitch.Check) {
+	for _, check := range checks {
+		fmt.Fprintf(w, "[%s] %s: %s\n", check.Status, check.Name, check.Message)
+		if check.Advice != "" {
+			fmt.Fprintf(w, "       -> %s\n", check.Advice)
+		}
+	}
+}
+
+// apiLevel is raised whenever a command or output format that integrations
+// such as the Neovim plugin rely on is added or changed, so that they can tell
+// an outdated binary apart from a current one.
+const apiLevel = 3
+
+// versionInfo describes the running binary, as printed by `im-switch version`.
+type versionInfo struct {
+	Version  string   `json:"version"`
+	Revision string   `json:"revision,omitempty"`
+	Modified bool     `json:"modified"`
+	Time     string   `json:"time,omitempty"`
+	Go       string   `json:"go"`
+	OS       string   `json:"os"`
+	Arch     string   `json:"arch"`
+	Cgo      bool     `json:"cgo"`
+	Backends []string `json:"backends"`
+	API      int      `json:"api"`
+}
+
+// readVersionInfo collects the build details recorded by the Go toolchain.
+// Builds outside a VCS checkout have no revision.
+func readVersionInfo() versionInfo {
+	info := versionInfo{
+		Version:  buildVersion(),
+		Go:       runtime.Version(),
+		OS:       runtime.GOOS,
+		Arch:     runtime.GOARCH,
+		Backends: imswitch.BackendNames(),
+		API:      apiLevel,
+	}
+	build, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	for _, setting := range build.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			info.Revision = setting.Value
+		case "vcs.modified":
+			info.Modified = setting.Value == "true"
+		case "vcs.time":
+			info.Time = setting.Value
+		case "CGO_ENABLED":
+			info.Cgo = setting.Value == "1"
+		}
+	}
+	return info
+}
+
+// runVersion implements `im-switch version`.
+func runVersion(c *cli, args []string) int {
+	fs := c.flagSet(lookupCommand("version"))
+	positional, code, ok := parseFlags(fs, args)
+	if !ok {
+		return code
+	}
+	if len(positional) > 0 {
+		return c.usageError("version takes no arguments")
+	}
+
+	info := readVersionInfo()
+	if c.opts.json {
+		writeJSON(c.stdout, info)
+		return exitOK
+	}
+
+	fmt.Fprintf(c.stdout, "im-switch %s\n", info.Version)
+	if info.Revision != "" {
+		revision := info.Revision
+		if info.Modified {
+			revision += " (modified)"
+		}
+		fmt.Fprintf(c.stdout, "  revision: %s\n", revision)
+	}
+	if info.Time != "" {
+		fmt.Fprintf(c.stdout, "  commit:   %s\n", info.Time)
+	}
+	fmt.Fprintf(c.stdout, "  go:       %s\n", info.Go)
+	fmt.Fprintf(c.stdout, "  platform: %s/%s\n", info.OS, info.Arch)
+	fmt.Fprintf(c.stdout, "  cgo:      %s\n", enabledString(info.Cgo))
+	fmt.Fprintf(c.stdout, "  backends: %s\n", strings.Join(info.Backends, ", "))
+	fmt.Fprintf(c.stdout, "  api:      %d\n", info.API)
+	return exitOK
+}
+
+func enabledString(enabled bool) string {
+	if enabled {
+		return "enabled"
+	}
+	return "disabled"
+}
+
+// buildVersion returns version, or the module version when installed with
+// `go install` and no version was set at build time.
+func buildVersion() string {
+	if version != "dev" {
+		return version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	return version
+}
+
+// runHelp implements `im-switch help`. Like every command it prints its own
+// usage for -h, which is also how `help help` is answered.
+func runHelp(c *cli, args []string) int {
+	fs := c.flagSet(lookupCommand("help"))
+	positional, code, ok := parseFlags(fs, args)
+	if !ok {
+		return code
+	}
+	switch len(positional) {
+	case 0:
+		printUsage(c.stdout)
+		return exitOK
+	case 1:
+		cmd := lookupCommand(positional[0])
+		if cmd == nil {
+			return c.usageError(fmt.Sprintf("unknown command '%s'", positional[0]))
+		}
+		// Let the command print its own usage so that its flags are listed,
+		// but on stdout since help was asked for.
+		return cmd.run(&cli{stdout: c.stdout, stderr: c.stdout, opts: c.opts}, []string{"-h"})
+	default:
+		return c.usageError("help takes at most one command")
+	}
+}
+
+// jsonSource is an input source as written by --json output.
+type jsonSource struct {
+	imswitch.InputSource
+	Current bool `json:"current"`
+}
+
+// writeSourceTable prints sources as aligned ID, kind, language and name
+// columns.
+func writeSourceTable(w io.Writer, sources []imswitch.InputSource) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tKIND\tLANGUAGE\tNAME")
+	for _, source := range sources {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", source.ID, orDash(string(source.Kind)), orDash(source.Language), orDash(source.Name))
+	}
+	tw.Flush()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
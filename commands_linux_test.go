@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeSetxkbmap is a setxkbmap that keeps the layout list in $XKB_STATE. It
+// rejects layouts it does not know like the real one, and fails every call
+// when $XKB_DISPLAY_ERROR is set.
+const fakeSetxkbmap = `#!/bin/sh
+if [ -n "$XKB_DISPLAY_ERROR" ]; then
+	echo 'Cannot open display "default display"' >&2
+	exit 1
+fi
+if [ "$1" = -query ]; then
+	printf 'rules:      evdev\nmodel:      pc105\nlayout:     %s\n' "$(cat "$XKB_STATE")"
+	exit 0
+fi
+case "$1" in
+us|kr|de|dvorak) printf '%s' "$1" >"$XKB_STATE" ;;
+*)
+	echo 'Error loading new keyboard description' >&2
+	exit 255
+	;;
+esac
+`
+
+// useFakeSetxkbmap puts fakeSetxkbmap first on PATH with the given layout
+// list and returns the file holding the list.
+func useFakeSetxkbmap(t *testing.T, layouts string) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "setxkbmap"), []byte(fakeSetxkbmap), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	state := filepath.Join(dir, "layouts")
+	if err := os.WriteFile(state, []byte(layouts), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("XKB_STATE", state)
+	return state
+}
+
+// runXKB runs the CLI against the xkb backend.
+func runXKB(args ...string) (code int, stdout, stderr string) {
+	var out, errOut bytes.Buffer
+	code = run(append([]string{"--backend", "xkb"}, args...), &out, &errOut)
+	return code, out.String(), errOut.String()
+}
+
+func TestRunCycleKeepsXKBLayoutList(t *testing.T) {
+	state := useFakeSetxkbmap(t, "us,kr")
+	t.Setenv("IM_SWITCH_CONFIG", filepath.Join(t.TempDir(), "config.json"))
+
+	for i := 0; i < 3; i++ {
+		code, _, stderr := runXKB("cycle")
+		if code != exitFailure || !strings.Contains(stderr, "pass the ring as arguments") {
+			t.Errorf("cycle = %d, %q, want a request for a ring", code, stderr)
+		}
+	}
+	if layouts, _ := os.ReadFile(state); string(layouts) != "us,kr" {
+		t.Errorf("cycle left the layout list at %q, want us,kr", layouts)
+	}
+}
+
+func TestRunSetXKB(t *testing.T) {
+	state := useFakeSetxkbmap(t, "us")
+
+	code, stdout, stderr := runXKB("set", "xkb:us::eng", "us(nope)", "dvorak")
+	if code != exitOK || stdout != "dvorak\n" {
+		t.Errorf("set with an unlisted layout = %d, %q (stderr: %q), want dvorak", code, stdout, stderr)
+	}
+	if layouts, _ := os.ReadFile(state); string(layouts) != "dvorak" {
+		t.Errorf("layout list = %q, want dvorak", layouts)
+	}
+
+	t.Setenv("XKB_DISPLAY_ERROR", "1")
+	code, _, stderr = runXKB("set", "us", "kr")
+	if code != exitCommandFailed || !strings.Contains(stderr, "Cannot open display") {
+		t.Errorf("set without a display = %d, %q, want the setxkbmap error", code, stderr)
+	}
+}
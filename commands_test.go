@@ -0,0 +1,722 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chojs23/im-switch/imswitch"
+)
+
+// memBackend is an in-memory backend registered as "test" so that every CLI
+// path can run without an input method framework.
+type memBackend struct {
+	current string
+	sources []string
+	sets    []string
+	// stuck makes Set succeed without switching, like a daemon that ignores
+	// the request.
+	stuck bool
+	// enabled is what Enabled reports; nil means the backend cannot tell.
+	enabled []string
+}
+
+func (b *memBackend) Name() string    { return "test" }
+func (b *memBackend) Available() bool { return true }
+
+func (b *memBackend) Current(ctx context.Context) (string, error) {
+	return b.current, nil
+}
+
+func (b *memBackend) List(ctx context.Context) ([]imswitch.InputSource, error) {
+	sources := make([]imswitch.InputSource, 0, len(b.sources))
+	for _, id := range b.sources {
+		sources = append(sources, imswitch.InputSource{ID: id, Name: "Test " + id, Backend: "test", Kind: imswitch.KindLayout})
+	}
+	return sources, nil
+}
+
+func (b *memBackend) Enabled(ctx context.Context) ([]string, error) {
+	return b.enabled, nil
+}
+
+func (b *memBackend) Set(ctx context.Context, sourceID string) error {
+	for _, id := range b.sources {
+		if id == sourceID {
+			if !b.stuck {
+				b.current = sourceID
+			}
+			b.sets = append(b.sets, sourceID)
+			return nil
+		}
+	}
+	return &imswitch.Error{Kind: imswitch.ErrUnknownSource, Backend: "test", Source: sourceID}
+}
+
+// useMemBackend registers a fresh memBackend and returns it.
+func useMemBackend(t *testing.T) *memBackend {
+	t.Helper()
+	b := &memBackend{current: "us", sources: []string{"us", "kr", "de"}}
+	imswitch.Register(b, 1000)
+	return b
+}
+
+// runCLI runs the CLI against the test backend and returns its exit code and
+// output.
+func runCLI(args ...string) (code int, stdout, stderr string) {
+	var out, errOut bytes.Buffer
+	code = run(append([]string{"--backend", "test"}, args...), &out, &errOut)
+	return code, out.String(), errOut.String()
+}
+
+func TestRunCommands(t *testing.T) {
+	testCases := []struct {
+		name    string
+		args    []string
+		code    int
+		stdout  string
+		current string
+	}{
+		{"no arguments", nil, exitOK, "us\n", "us"},
+		{"get", []string{"get"}, exitOK, "us\n", "us"},
+		{"set", []string{"set", "kr"}, exitOK, "", "kr"},
+		{"bare ID", []string{"de"}, exitOK, "", "de"},
+		{"set unknown", []string{"set", "xx"}, exitUnknownSource, "", "us"},
+		{"list", []string{"list"}, exitOK, "us\nkr\nde\n", "us"},
+		{"list shorthand", []string{"-l"}, exitOK, "us\nkr\nde\n", "us"},
+		{"toggle from first", []string{"toggle", "us", "kr"}, exitOK, "kr\n", "kr"},
+		{"toggle from other", []string{"toggle", "kr", "de"}, exitOK, "kr\n", "kr"},
+		{"toggle wraps around", []string{"toggle", "kr", "de", "us"}, exitOK, "kr\n", "kr"},
+		{"toggle to current", []string{"toggle", "us", "us"}, exitOK, "us\n", "us"},
+		{"toggle unknown target", []string{"toggle", "us", "xx"}, exitUnknownSource, "", "us"},
+		{"flags after command", []string{"set", "kr", "--timeout", "1s"}, exitOK, "", "kr"},
+		{"detect", []string{"detect"}, exitOK, "test\n", "us"},
+		{"unknown option", []string{"-x"}, exitUsage, "", "us"},
+		{"unknown command", []string{"frobnicate", "us"}, exitUsage, "", "us"},
+		{"unknown flag", []string{"list", "--wide"}, exitUsage, "", "us"},
+		{"set without ID", []string{"set"}, exitUsage, "", "us"},
+		{"set first listed", []string{"set", "xx", "kr", "de"}, exitOK, "kr\n", "kr"},
+		{"set none listed", []string{"set", "xx", "yy"}, exitUnknownSource, "", "us"},
+		{"toggle with one ID", []string{"toggle", "us"}, exitUsage, "", "us"},
+		{"get with argument", []string{"get", "us"}, exitUsage, "", "us"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			b := useMemBackend(t)
+			code, stdout, stderr := runCLI(tc.args...)
+			if code != tc.code {
+				t.Fatalf("run(%v) = %d, want %d (stderr: %q)", tc.args, code, tc.code, stderr)
+			}
+			if stdout != tc.stdout {
+				t.Errorf("run(%v) stdout = %q, want %q", tc.args, stdout, tc.stdout)
+			}
+			if b.current != tc.current {
+				t.Errorf("run(%v) left current = %q, want %q", tc.args, b.current, tc.current)
+			}
+			if code != exitOK && stderr == "" {
+				t.Errorf("run(%v) failed without writing to stderr", tc.args)
+			}
+		})
+	}
+}
+
+func TestNextInRing(t *testing.T) {
+	ring := []string{"us", "kr", "de"}
+	testCases := []struct {
+		current string
+		reverse bool
+		want    string
+	}{
+		{"us", false, "kr"},
+		{"kr", false, "de"},
+		{"de", false, "us"},
+		{"jp", false, "us"},
+		{"", false, "us"},
+		{"us", true, "de"},
+		{"kr", true, "us"},
+		{"jp", true, "us"},
+	}
+
+	for _, tc := range testCases {
+		if got := nextInRing(ring, tc.current, tc.reverse); got != tc.want {
+			t.Errorf("nextInRing(%v, %q, %v) = %q, want %q", ring, tc.current, tc.reverse, got, tc.want)
+		}
+	}
+}
+
+func TestRunCycle(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	t.Setenv(configEnvVar, path)
+
+	testCases := []struct {
+		name    string
+		config  string
+		enabled []string
+		args    []string
+		code    int
+		want    string
+	}{
+		{"enabled sources", "", []string{"us", "de"}, []string{"cycle"}, exitOK, "de"},
+		{"enabled sources reversed", "", []string{"kr", "us", "de"}, []string{"cycle", "--reverse"}, exitOK, "kr"},
+		{"enabled sources unknown", "", nil, []string{"cycle"}, exitFailure, "us"},
+		{"arguments", "", nil, []string{"cycle", "de", "us", "kr"}, exitOK, "kr"},
+		{"arguments reversed", "", nil, []string{"cycle", "--reverse", "kr", "de", "us"}, exitOK, "de"},
+		{"config ring", `{"ring": ["de", "us"]}`, nil, []string{"cycle"}, exitOK, "de"},
+		{"arguments override config", `{"ring": ["de", "us"]}`, nil, []string{"cycle", "us", "kr"}, exitOK, "kr"},
+		{"current not in ring", `{"ring": ["kr", "de"]}`, nil, []string{"cycle"}, exitOK, "kr"},
+		{"invalid config", `{"ring": `, nil, []string{"cycle"}, exitFailure, "us"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			os.Remove(path)
+			if tc.config != "" {
+				if err := os.WriteFile(path, []byte(tc.config), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			b := useMemBackend(t)
+			b.enabled = tc.enabled
+			code, stdout, stderr := runCLI(tc.args...)
+			if code != tc.code {
+				t.Fatalf("run(%v) = %d, want %d (stderr: %q)", tc.args, code, tc.code, stderr)
+			}
+			if b.current != tc.want {
+				t.Errorf("run(%v) switched to %q, want %q", tc.args, b.current, tc.want)
+			}
+			if code == exitOK && stdout != tc.want+"\n" {
+				t.Errorf("run(%v) stdout = %q, want %q", tc.args, stdout, tc.want+"\n")
+			}
+		})
+	}
+}
+
+func TestRunHelp(t *testing.T) {
+	useMemBackend(t)
+
+	for _, args := range [][]string{{"--help"}, {"help"}} {
+		code, stdout, _ := runCLI(args...)
+		if code != exitOK || !strings.Contains(stdout, "Commands:") {
+			t.Errorf("run(%v) = %d, stdout %q; want usage", args, code, stdout)
+		}
+	}
+
+	code, stdout, _ := runCLI("help", "list")
+	if code != exitOK || !strings.Contains(stdout, "im-switch list") || !strings.Contains(stdout, "-long") {
+		t.Errorf("help list = %d, stdout %q; want list usage", code, stdout)
+	}
+
+	code, _, stderr := runCLI("list", "-h")
+	if code != exitOK || !strings.Contains(stderr, "-long") {
+		t.Errorf("list -h = %d, stderr %q; want list usage", code, stderr)
+	}
+
+	code, stdout, _ = runCLI("help", "help")
+	if code != exitOK || !strings.Contains(stdout, "im-switch help") {
+		t.Errorf("help help = %d, stdout %q; want help usage", code, stdout)
+	}
+
+	if code, _, _ := runCLI("help", "frobnicate"); code != exitUsage {
+		t.Errorf("help frobnicate = %d, want %d", code, exitUsage)
+	}
+}
+
+func TestRunJSON(t *testing.T) {
+	useMemBackend(t)
+
+	code, stdout, _ := runCLI("get", "--json")
+	var source jsonSource
+	if code != exitOK || json.Unmarshal([]byte(stdout), &source) != nil {
+		t.Fatalf("get --json = %d, %q", code, stdout)
+	}
+	if source.ID != "us" || !source.Current {
+		t.Errorf("get --json = %+v, want current us", source)
+	}
+
+	code, stdout, _ = runCLI("--json", "set", "xx")
+	var payload map[string]jsonError
+	if code != exitUnknownSource || json.Unmarshal([]byte(stdout), &payload) != nil {
+		t.Fatalf("set --json xx = %d, %q", code, stdout)
+	}
+	if payload["error"].Code != "unknown_source" || payload["error"].Source != "xx" {
+		t.Errorf("set --json xx error = %+v", payload["error"])
+	}
+}
+
+func TestRunVerify(t *testing.T) {
+	b := useMemBackend(t)
+
+	if code, stdout, stderr := runCLI("--verify", "set", "kr"); code != exitOK || stdout != "" {
+		t.Fatalf("--verify set kr = %d, %q (stderr: %q)", code, stdout, stderr)
+	}
+	if len(b.sets) != 1 {
+		t.Errorf("sets = %v, want a single switch", b.sets)
+	}
+
+	b.stuck, b.sets = true, nil
+	code, _, stderr := runCLI("set", "--verify", "de")
+	if code != exitMismatch {
+		t.Fatalf("set --verify de on a stuck backend = %d, want %d", code, exitMismatch)
+	}
+	if !strings.Contains(stderr, "expected de, got kr") {
+		t.Errorf("stderr = %q, want the expected and actual sources", stderr)
+	}
+	if len(b.sets) != 1+imswitch.DefaultVerifyRetries {
+		t.Errorf("sets = %v, want %d attempts", b.sets, 1+imswitch.DefaultVerifyRetries)
+	}
+}
+
+func TestRunResolve(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	t.Setenv(configEnvVar, path)
+	if err := os.WriteFile(path, []byte(`{"aliases": {"korean": "kr"}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name    string
+		args    []string
+		code    int
+		stdout  string
+		stderr  string
+		current string
+	}{
+		{"alias", []string{"set", "korean"}, exitOK, "", "", "kr"},
+		{"ID ignoring case", []string{"set", "DE"}, exitOK, "", "", "de"},
+		{"display name", []string{"set", "test kr"}, exitOK, "", "", "kr"},
+		{"bare name", []string{"Test de"}, exitOK, "", "", "de"},
+		{"ambiguous", []string{"set", "test"}, exitUnknownSource, "", "matches us, kr, de", "us"},
+		{"suggestion", []string{"set", "krr"}, exitUnknownSource, "", "did you mean kr?", "us"},
+		{"toggle", []string{"toggle", "US", "korean"}, exitOK, "kr\n", "", "kr"},
+		{"push", []string{"push", "korean"}, exitOK, "us -> kr\n", "", "kr"},
+		{"alias among several", []string{"set", "xx", "korean"}, exitOK, "kr\n", "", "kr"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("XDG_STATE_HOME", t.TempDir())
+			b := useMemBackend(t)
+			code, stdout, stderr := runCLI(tc.args...)
+			if code != tc.code || stdout != tc.stdout {
+				t.Errorf("run(%v) = %d, %q, want %d, %q (stderr: %q)", tc.args, code, stdout, tc.code, tc.stdout, stderr)
+			}
+			if !strings.Contains(stderr, tc.stderr) {
+				t.Errorf("run(%v) stderr = %q, want it to contain %q", tc.args, stderr, tc.stderr)
+			}
+			if b.current != tc.current {
+				t.Errorf("run(%v) left current %q, want %q", tc.args, b.current, tc.current)
+			}
+		})
+	}
+
+	useMemBackend(t)
+	code, stdout, _ := runCLI("--json", "set", "krr")
+	var payload map[string]jsonError
+	if code != exitUnknownSource || json.Unmarshal([]byte(stdout), &payload) != nil {
+		t.Fatalf("--json set krr = %d, %q", code, stdout)
+	}
+	if got := payload["error"].Candidates; len(got) != 1 || got[0] != "kr" {
+		t.Errorf("--json set krr candidates = %v, want [kr]", got)
+	}
+}
+
+func TestRunFormat(t *testing.T) {
+	testCases := []struct {
+		name   string
+		args   []string
+		code   int
+		stdout string
+	}{
+		{"get template", []string{"get", "--format", "{{.Name}} ({{.Backend}})"}, exitOK, "Test us (test)\n"},
+		{"get short", []string{"get", "--format", "short"}, exitOK, "us\n"},
+		{"get long", []string{"get", "--format", "long"}, exitOK, "us  layout  -  Test us\n"},
+		{"list template", []string{"list", "--format", "{{if .Current}}*{{end}}{{upper .ID}}"}, exitOK, "*US\nKR\nDE\n"},
+		{"list long", []string{"list", "--format", "long"}, exitOK, "ID  KIND    LANGUAGE  NAME\nus  layout  -         Test us\nkr  layout  -         Test kr\nde  layout  -         Test de\n"},
+		{"watch template", []string{"watch", "--count", "1", "--format", "{{.ID}}:{{.Kind}}"}, exitOK, "us:layout\n"},
+		{"get slice", []string{"get", "--format", "{{slice .ID 0 1}}"}, exitOK, "u\n"},
+		{"unknown field", []string{"get", "--format", "{{.Flag}}"}, exitUsage, ""},
+		{"syntax error", []string{"list", "--format", "{{.ID"}, exitUsage, ""},
+		{"with --json", []string{"get", "--json", "--format", "short"}, exitUsage, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			useMemBackend(t)
+			code, stdout, stderr := runCLI(tc.args...)
+			if code != tc.code || stdout != tc.stdout {
+				t.Errorf("run(%v) = %d, %q, want %d, %q (stderr: %q)", tc.args, code, stdout, tc.code, tc.stdout, stderr)
+			}
+		})
+	}
+
+	useMemBackend(t)
+	code, stdout, _ := runCLI("get", "--format", "json")
+	var source jsonSource
+	if code != exitOK || json.Unmarshal([]byte(stdout), &source) != nil || source.ID != "us" {
+		t.Errorf("get --format json = %d, %q, want the --json output", code, stdout)
+	}
+}
+
+func TestRunVersion(t *testing.T) {
+	useMemBackend(t)
+
+	for _, args := range [][]string{{"version"}, {"--version"}} {
+		code, stdout, _ := runCLI(args...)
+		if code != exitOK || !strings.HasPrefix(stdout, "im-switch dev\n") {
+			t.Errorf("run(%v) = %d, %q, want the version first", args, code, stdout)
+		}
+		for _, field := range []string{"go:", "platform:", "cgo:", "backends:", "api:"} {
+			if !strings.Contains(stdout, field) {
+				t.Errorf("run(%v) = %q, want a %s line", args, stdout, field)
+			}
+		}
+	}
+
+	code, stdout, _ := runCLI("version", "--json")
+	var info versionInfo
+	if code != exitOK || json.Unmarshal([]byte(stdout), &info) != nil {
+		t.Fatalf("version --json = %d, %q", code, stdout)
+	}
+	if info.Version != "dev" || info.Go != runtime.Version() || info.OS != runtime.GOOS || info.API != apiLevel {
+		t.Errorf("version --json = %+v", info)
+	}
+	if !slices.Contains(info.Backends, "test") {
+		t.Errorf("version --json backends = %v, want the registered test backend", info.Backends)
+	}
+}
+
+func TestRunSetSeveral(t *testing.T) {
+	useMemBackend(t)
+
+	code, stdout, _ := runCLI("--json", "set", "xkb:us::eng", "keyboard-us", "de")
+	var result setResult
+	if code != exitOK || json.Unmarshal([]byte(stdout), &result) != nil || result.Selected != "de" {
+		t.Errorf("--json set with several IDs = %d, %q, want de selected", code, stdout)
+	}
+
+	code, _, stderr := runCLI("set", "xkb:us::eng", "keyboard-us")
+	if code != exitUnknownSource || !strings.Contains(stderr, "none of xkb:us::eng, keyboard-us is available") {
+		t.Errorf("set with no listed ID = %d, %q", code, stderr)
+	}
+
+	// Every candidate is resolved as a single ID would be.
+	code, stdout, _ = runCLI("--json", "set", "xkb:us::eng", "Test kr", "de")
+	if code != exitOK || json.Unmarshal([]byte(stdout), &result) != nil || result.Selected != "kr" {
+		t.Errorf("--json set with a display name among several = %d, %q, want kr selected", code, stdout)
+	}
+}
+
+func TestRunSetReportsSelection(t *testing.T) {
+	useMemBackend(t)
+
+	code, stdout, _ := runCLI("--json", "set", "DE")
+	var result setResult
+	if code != exitOK || json.Unmarshal([]byte(stdout), &result) != nil || result.Selected != "de" {
+		t.Errorf("--json set DE = %d, %q, want de selected", code, stdout)
+	}
+	if code, stdout, _ := runCLI("set", "kr"); code != exitOK || stdout != "" {
+		t.Errorf("set kr = %d, %q, want a silent switch", code, stdout)
+	}
+}
+
+func TestRunUnknownBackend(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"--backend", "nonexistent", "get"}, &stdout, &stderr)
+	if code != exitBackendUnavailable {
+		t.Errorf("run with unknown backend = %d, want %d", code, exitBackendUnavailable)
+	}
+	if !strings.Contains(stderr.String(), "unknown backend") {
+		t.Errorf("stderr = %q, want unknown backend error", stderr.String())
+	}
+}
+
+func TestRunSaveRestore(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	b := useMemBackend(t)
+
+	if code, stdout, stderr := runCLI("save", "work"); code != exitOK || stdout != "us\n" {
+		t.Fatalf("save work = %d, %q (stderr: %q)", code, stdout, stderr)
+	}
+	b.current = "kr"
+
+	code, stdout, stderr := runCLI("restore", "work")
+	if code != exitOK || stdout != "kr -> us\n" || b.current != "us" {
+		t.Fatalf("restore work = %d, %q, current %q (stderr: %q)", code, stdout, b.current, stderr)
+	}
+	if code, stdout, _ := runCLI("restore", "work"); code != exitOK || stdout != "us (unchanged)\n" {
+		t.Errorf("second restore work = %d, %q; want unchanged", code, stdout)
+	}
+	if code, _, _ := runCLI("restore", "missing"); code != exitFailure {
+		t.Errorf("restore missing = %d, want %d", code, exitFailure)
+	}
+	if code, _, _ := runCLI("save"); code != exitUsage {
+		t.Errorf("save without slot = %d, want %d", code, exitUsage)
+	}
+}
+
+func TestRunRestoreRejectsOtherBackend(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", dir)
+	b := useMemBackend(t)
+
+	state := `{"slots": {"work": {"id": "kr", "backend": "ibus"}}}`
+	if err := os.MkdirAll(filepath.Join(dir, "im-switch"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "im-switch", "state.json"), []byte(state), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if code, _, _ := runCLI("restore", "work"); code != exitBackendUnavailable {
+		t.Errorf("restore of ibus slot = %d, want %d", code, exitBackendUnavailable)
+	}
+	if b.current != "us" {
+		t.Errorf("restore of ibus slot switched to %q", b.current)
+	}
+}
+
+func TestRunPushPop(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	b := useMemBackend(t)
+
+	steps := []struct {
+		args    []string
+		code    int
+		stdout  string
+		current string
+	}{
+		{[]string{"push", "kr"}, exitOK, "us -> kr\n", "kr"},
+		{[]string{"push", "de"}, exitOK, "kr -> de\n", "de"},
+		{[]string{"push", "xx"}, exitUnknownSource, "", "de"},
+		{[]string{"pop"}, exitOK, "de -> kr\n", "kr"},
+		{[]string{"push"}, exitOK, "kr\n", "kr"},
+		{[]string{"pop"}, exitOK, "kr (unchanged)\n", "kr"},
+		{[]string{"pop"}, exitOK, "kr -> us\n", "us"},
+		{[]string{"pop"}, exitFailure, "", "us"},
+	}
+
+	for _, step := range steps {
+		code, stdout, stderr := runCLI(step.args...)
+		if code != step.code || stdout != step.stdout || b.current != step.current {
+			t.Fatalf("run(%v) = %d, %q, current %q; want %d, %q, current %q (stderr: %q)",
+				step.args, code, stdout, b.current, step.code, step.stdout, step.current, stderr)
+		}
+	}
+}
+
+// imeMemBackend is registered as "test" in place of memBackend. Like the
+// Windows backend, it reports the ko layout as current while Set only opens
+// or closes an IME.
+type imeMemBackend struct {
+	open bool
+}
+
+func (b *imeMemBackend) Name() string    { return "test" }
+func (b *imeMemBackend) Available() bool { return true }
+
+func (b *imeMemBackend) Current(ctx context.Context) (string, error) {
+	return "ko", nil
+}
+
+func (b *imeMemBackend) List(ctx context.Context) ([]imswitch.InputSource, error) {
+	return []imswitch.InputSource{{ID: "en", Backend: "test"}, {ID: "ko", Backend: "test"}}, nil
+}
+
+func (b *imeMemBackend) Set(ctx context.Context, sourceID string) error {
+	b.open = sourceID == "ko"
+	return nil
+}
+
+func (b *imeMemBackend) Verify(ctx context.Context, sourceID string) (string, bool, error) {
+	return "ko", b.open == (sourceID == "ko"), nil
+}
+
+func TestRunPopOpensIME(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	b := &imeMemBackend{open: true}
+	imswitch.Register(b, 1000)
+
+	if code, _, stderr := runCLI("push", "en"); code != exitOK || b.open {
+		t.Fatalf("push en = %d, IME open %v (stderr: %q)", code, b.open, stderr)
+	}
+	if code, stdout, stderr := runCLI("pop"); code != exitOK || !b.open || stdout != "ko -> ko\n" {
+		t.Errorf("pop = %d, %q, IME open %v; want the IME opened again (stderr: %q)", code, stdout, b.open, stderr)
+	}
+}
+
+func TestStackDepth(t *testing.T) {
+	var state stateFile
+	for i := 0; i < maxStackDepth+5; i++ {
+		state.push(savedSource{InputSource: imswitch.InputSource{ID: fmt.Sprint(i)}})
+	}
+	if len(state.Stack) != maxStackDepth {
+		t.Fatalf("stack depth = %d, want %d", len(state.Stack), maxStackDepth)
+	}
+	if state.Stack[0].ID != "5" {
+		t.Errorf("oldest entry = %q, want 5", state.Stack[0].ID)
+	}
+}
+
+// TestExecHelperProcess is not a real test; exec tests run the test binary
+// with it as the child command.
+func TestExecHelperProcess(t *testing.T) {
+	if os.Getenv("IM_SWITCH_EXEC_HELPER") != "1" {
+		return
+	}
+	fmt.Fprint(os.Stdout, strings.Join(os.Args[len(os.Args)-1:], " "))
+	if d, err := time.ParseDuration(os.Getenv("IM_SWITCH_EXEC_SLEEP")); err == nil {
+		time.Sleep(d)
+	}
+	code, _ := strconv.Atoi(os.Getenv("IM_SWITCH_EXEC_EXIT"))
+	os.Exit(code)
+}
+
+func TestRunExec(t *testing.T) {
+	t.Setenv("IM_SWITCH_EXEC_HELPER", "1")
+	t.Setenv("IM_SWITCH_EXEC_EXIT", "3")
+	b := useMemBackend(t)
+
+	code, stdout, stderr := runCLI("exec", "--input", "kr", "--", os.Args[0], "-test.run=TestExecHelperProcess", "--", "-v")
+	if code != 3 {
+		t.Fatalf("exec = %d, want the child's exit code 3 (stderr: %q)", code, stderr)
+	}
+	if stdout != "-v" {
+		t.Errorf("child stdout = %q, want its own arguments passed through", stdout)
+	}
+	if want := []string{"kr", "us"}; strings.Join(b.sets, ",") != strings.Join(want, ",") {
+		t.Errorf("exec switched %v, want %v", b.sets, want)
+	}
+}
+
+func TestRunExecErrors(t *testing.T) {
+	testCases := []struct {
+		name string
+		args []string
+		code int
+		sets string
+	}{
+		{"missing input", []string{"exec", "true"}, exitUsage, ""},
+		{"missing command", []string{"exec", "--input", "kr"}, exitUsage, ""},
+		{"unknown input", []string{"exec", "--input", "xx", "true"}, exitUnknownSource, ""},
+		{"command not found", []string{"exec", "--input", "kr", "im-switch-no-such-command"}, 127, "kr,us"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			b := useMemBackend(t)
+			code, _, stderr := runCLI(tc.args...)
+			if code != tc.code {
+				t.Fatalf("run(%v) = %d, want %d (stderr: %q)", tc.args, code, tc.code, stderr)
+			}
+			if strings.Join(b.sets, ",") != tc.sets {
+				t.Errorf("run(%v) switched %v, want %q", tc.args, b.sets, tc.sets)
+			}
+		})
+	}
+}
+
+func TestRunWatch(t *testing.T) {
+	useMemBackend(t)
+
+	code, stdout, stderr := runCLI("watch", "--count", "1")
+	if code != exitOK || stdout != "us\n" {
+		t.Fatalf("watch --count 1 = %d, %q (stderr: %q)", code, stdout, stderr)
+	}
+
+	code, stdout, _ = runCLI("--json", "watch", "--count", "1")
+	var event watchEvent
+	if code != exitOK || strings.Count(stdout, "\n") != 1 || json.Unmarshal([]byte(stdout), &event) != nil {
+		t.Fatalf("watch --json --count 1 = %d, %q; want one JSON line", code, stdout)
+	}
+	if event.ID != "us" || event.Name != "Test us" || event.Time.IsZero() {
+		t.Errorf("watch --json event = %+v", event)
+	}
+}
+
+func TestRunWaitFor(t *testing.T) {
+	useMemBackend(t)
+
+	if code, stdout, stderr := runCLI("wait-for", "us"); code != exitOK || stdout != "" {
+		t.Errorf("wait-for us = %d, %q (stderr: %q); want immediate success", code, stdout, stderr)
+	}
+
+	start := time.Now()
+	code, _, stderr := runCLI("wait-for", "kr", "--timeout", "100ms", "--interval", "10ms")
+	if code != exitTimeout {
+		t.Fatalf("wait-for kr = %d, want %d (stderr: %q)", code, exitTimeout, stderr)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond || elapsed > 5*time.Second {
+		t.Errorf("wait-for kr returned after %s, want about 100ms", elapsed)
+	}
+	if !strings.Contains(stderr, "current: us") {
+		t.Errorf("wait-for kr stderr = %q, want the current source", stderr)
+	}
+
+	code, stdout, _ := runCLI("--json", "--timeout", "50ms", "wait-for", "kr")
+	var payload map[string]jsonError
+	if code != exitTimeout || json.Unmarshal([]byte(stdout), &payload) != nil || payload["error"].Code != "timeout" {
+		t.Errorf("wait-for --json kr = %d, %q; want a timeout error", code, stdout)
+	}
+
+	if code, _, _ := runCLI("wait-for"); code != exitUsage {
+		t.Errorf("wait-for without ID = %d, want %d", code, exitUsage)
+	}
+}
+
+func TestRunDoctor(t *testing.T) {
+	t.Setenv(configEnvVar, filepath.Join(t.TempDir(), "config.json"))
+	useMemBackend(t)
+
+	// Platform checks depend on the machine, so only the backend checks are
+	// asserted here.
+	_, stdout, _ := runCLI("--json", "doctor", "--default", "jp")
+	var report struct {
+		OK     bool             `json:"ok"`
+		Checks []imswitch.Check `json:"checks"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &report); err != nil {
+		t.Fatalf("doctor --json output %q: %v", stdout, err)
+	}
+	got := map[string]imswitch.CheckStatus{}
+	for _, check := range report.Checks {
+		got[check.Name] = check.Status
+	}
+	expected := map[string]imswitch.CheckStatus{
+		"backend": imswitch.CheckPass,
+		"current": imswitch.CheckPass,
+		"list":    imswitch.CheckPass,
+		"default": imswitch.CheckWarn,
+	}
+	for name, status := range expected {
+		if got[name] != status {
+			t.Errorf("doctor check %s = %q, want %q", name, got[name], status)
+		}
+	}
+}
+
+func TestWriteChecks(t *testing.T) {
+	var buf bytes.Buffer
+	writeChecks(&buf, []imswitch.Check{
+		{Name: "backend", Status: imswitch.CheckPass, Message: "using ibus"},
+		{Name: "daemons", Status: imswitch.CheckWarn, Message: "ibus and fcitx5 are running at the same time", Advice: "stop one"},
+	})
+
+	expected := "[pass] backend: using ibus\n" +
+		"[warn] daemons: ibus and fcitx5 are running at the same time\n" +
+		"       -> stop one\n"
+	if buf.String() != expected {
+		t.Errorf("writeChecks() =\n%s\nwant\n%s", buf.String(), expected)
+	}
+}
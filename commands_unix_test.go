@@ -0,0 +1,51 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRunExecForwardsSignals(t *testing.T) {
+	t.Setenv("IM_SWITCH_EXEC_HELPER", "1")
+	t.Setenv("IM_SWITCH_EXEC_SLEEP", "10s")
+	b := useMemBackend(t)
+
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		syscall.Kill(os.Getpid(), syscall.SIGTERM)
+	}()
+
+	code, _, stderr := runCLI("exec", "--input", "kr", os.Args[0], "-test.run=TestExecHelperProcess")
+	if code != 128+int(syscall.SIGTERM) {
+		t.Fatalf("exec = %d, want %d (stderr: %q)", code, 128+int(syscall.SIGTERM), stderr)
+	}
+	if got := strings.Join(b.sets, ","); got != "kr,us" {
+		t.Errorf("exec switched %v, want the original source restored", b.sets)
+	}
+}
+
+func TestRunExecDoesNotForwardInterrupt(t *testing.T) {
+	t.Setenv("IM_SWITCH_EXEC_HELPER", "1")
+	t.Setenv("IM_SWITCH_EXEC_SLEEP", "500ms")
+	b := useMemBackend(t)
+
+	// The terminal sends Ctrl-C to the child itself, so im-switch must only
+	// survive it rather than send a second one.
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		syscall.Kill(os.Getpid(), syscall.SIGINT)
+	}()
+
+	code, _, stderr := runCLI("exec", "--input", "kr", os.Args[0], "-test.run=TestExecHelperProcess")
+	if code != 0 {
+		t.Fatalf("exec = %d, want the child to finish normally (stderr: %q)", code, stderr)
+	}
+	if got := strings.Join(b.sets, ","); got != "kr,us" {
+		t.Errorf("exec switched %v, want the original source restored", b.sets)
+	}
+}
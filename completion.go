@@ -0,0 +1,354 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/chojs23/im-switch/imswitch"
+)
+
+// completionScripts are printed by `im-switch completion <shell>`. Each one
+// passes the words typed so far to `im-switch __complete`, which prints one
+// "value<TAB>description" line per candidate.
+var completionScripts = map[string]string{
+	"bash": `# bash completion for im-switch
+# Load with: source <(im-switch completion bash)
+_im_switch() {
+    # Split the line ourselves: COMP_WORDS breaks IDs such as xkb:us::eng
+    # apart at the colons.
+    local line="${COMP_LINE:0:COMP_POINT}"
+    local -a words
+    read -ra words <<< "$line"
+    [[ "$line" == *" " ]] && words+=("")
+    local cur="${words[${#words[@]}-1]}"
+
+    local IFS=$'\n'
+    COMPREPLY=($(compgen -W "$(command im-switch __complete "${words[@]:1}" 2>/dev/null | cut -f1)" -- "$cur"))
+
+    # Bash only replaces the part of the word after the last colon.
+    if [[ "$cur" == *:* && "$COMP_WORDBREAKS" == *:* ]]; then
+        local prefix="${cur%"${cur##*:}"}"
+        COMPREPLY=("${COMPREPLY[@]#"$prefix"}")
+    fi
+}
+complete -o default -F _im_switch im-switch
+`,
+	"zsh": `#compdef im-switch
+# zsh completion for im-switch
+# Load with: source <(im-switch completion zsh)
+_im_switch() {
+    local -a candidates
+    local line value desc
+    for line in "${(@f)$(command im-switch __complete "${(@)words[2,CURRENT]}" 2>/dev/null)}"; do
+        [[ -z "$line" ]] && continue
+        value="${line%%$'\t'*}"
+        desc=""
+        [[ "$line" == *$'\t'* ]] && desc="${line#*$'\t'}"
+        candidates+=("${value//:/\\:}${desc:+:$desc}")
+    done
+    if (( ${#candidates} )); then
+        _describe 'im-switch' candidates
+    else
+        _files
+    fi
+}
+compdef _im_switch im-switch
+`,
+	"fish": `# fish completion for im-switch
+# Load with: im-switch completion fish | source
+function __im_switch_complete
+    set -l tokens (commandline -opc)
+    # A quoted variable is always one argument, even when the token is empty.
+    set -l current (commandline -ct)
+    command im-switch __complete $tokens[2..-1] "$current" 2>/dev/null
+end
+complete -c im-switch -f -a '(__im_switch_complete)'
+`,
+}
+
+// runCompletion implements `im-switch completion`.
+func runCompletion(c *cli, args []string) int {
+	fs := c.flagSet(lookupCommand("completion"))
+	positional, code, ok := parseFlags(fs, args)
+	if !ok {
+		return code
+	}
+	if len(positional) != 1 {
+		return c.usageError("completion requires a shell: bash, zsh or fish")
+	}
+	script, ok := completionScripts[positional[0]]
+	if !ok {
+		return c.usageError(fmt.Sprintf("unsupported shell '%s' (use bash, zsh or fish)", positional[0]))
+	}
+	fmt.Fprint(c.stdout, script)
+	return exitOK
+}
+
+// candidate is one completion offered by __complete.
+type candidate struct {
+	value       string
+	description string
+}
+
+// runComplete implements the hidden `im-switch __complete` command. args are
+// the words after the program name; the last one is the word being
+// completed and may be empty.
+func runComplete(c *cli, args []string) int {
+	if len(args) == 0 {
+		args = []string{""}
+	}
+	for _, cand := range c.complete(args) {
+		if cand.description != "" {
+			fmt.Fprintf(c.stdout, "%s\t%s\n", cand.value, cand.description)
+		} else {
+			fmt.Fprintln(c.stdout, cand.value)
+		}
+	}
+	return exitOK
+}
+
+// globalFlags are the options accepted before any command, with whether they
+// take a value.
+var globalFlags = []struct {
+	name    string
+	value   bool
+	summary string
+}{
+	{"--backend", true, "use the named backend instead of detecting one"},
+	{"--json", false, "write output and errors as JSON on stdout"},
+	{"--timeout", true, "give up on the backend after this long"},
+	{"--verify", false, "check that switches take effect"},
+	{"--list", false, "list all input sources"},
+	{"--version", false, "show version information"},
+	{"--stdio", false, "answer commands read from stdin"},
+	{"--help", false, "show usage"},
+}
+
+// complete returns the candidates for the last of words that start with it.
+func (c *cli) complete(words []string) []candidate {
+	cur := words[len(words)-1]
+	words = words[:len(words)-1]
+
+	// Walk the finished words to find the command, the flag awaiting a value
+	// and how many arguments the command already has.
+	var cmd *command
+	var cmdFlags *flag.FlagSet
+	pending := ""
+	positional := 0
+	afterDashes := false
+	for _, word := range words {
+		switch {
+		case pending != "":
+			c.applyFlag(pending, word)
+			pending = ""
+		case afterDashes:
+			positional++
+		case word == "--":
+			afterDashes = true
+		case strings.HasPrefix(word, "-") && !strings.Contains(word, "="):
+			if takesValue(cmdFlags, word) {
+				pending = word
+			}
+		case strings.HasPrefix(word, "-"):
+			name, value, _ := strings.Cut(word, "=")
+			c.applyFlag(name, value)
+		case cmd == nil && positional == 0 && lookupCommand(word) != nil:
+			cmd = lookupCommand(word)
+			cmdFlags = c.commandFlags(cmd)
+		default:
+			positional++
+		}
+	}
+
+	var candidates []candidate
+	switch {
+	case pending != "":
+		candidates = c.flagValues(pending)
+	case strings.HasPrefix(cur, "-") && !afterDashes:
+		candidates = flagCandidates(cmd, cmdFlags)
+	case cmd == nil && positional == 0:
+		// The bare ID form means sources are valid here as well as commands.
+		for _, command := range commands {
+			if !hiddenCommand(command.name) {
+				candidates = append(candidates, candidate{command.name, command.summary})
+			}
+		}
+		candidates = append(candidates, c.sourceCandidates()...)
+	case cmd != nil:
+		candidates = c.argumentCandidates(cmd, positional)
+	}
+
+	var matches []candidate
+	for _, cand := range candidates {
+		if strings.HasPrefix(cand.value, cur) {
+			matches = append(matches, cand)
+		}
+	}
+	return matches
+}
+
+// commandFlags returns the FlagSet that cmd defines, found by running it with
+// -h and its output discarded.
+func (c *cli) commandFlags(cmd *command) *flag.FlagSet {
+	if cmd.name == "help" || hiddenCommand(cmd.name) {
+		return nil
+	}
+	probe := &cli{stdout: io.Discard, stderr: io.Discard, opts: c.opts}
+	cmd.run(probe, []string{"-h"})
+	return probe.flags
+}
+
+// takesValue reports whether the flag named by word expects a value.
+func takesValue(fs *flag.FlagSet, word string) bool {
+	name := strings.TrimLeft(word, "-")
+	for _, global := range globalFlags {
+		if global.name == "--"+name {
+			return global.value
+		}
+	}
+	if fs == nil {
+		return false
+	}
+	f := fs.Lookup(name)
+	if f == nil {
+		return false
+	}
+	if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() {
+		return false
+	}
+	return true
+}
+
+// applyFlag records global options so that sources are listed from the
+// backend the command line asks for.
+func (c *cli) applyFlag(name, value string) {
+	switch strings.TrimLeft(name, "-") {
+	case "backend":
+		c.opts.backend = value
+	case "timeout":
+		if timeout, err := parseTimeout(value); err == nil {
+			c.opts.timeout = timeout
+		}
+	}
+}
+
+func flagCandidates(cmd *command, fs *flag.FlagSet) []candidate {
+	var candidates []candidate
+	if fs == nil {
+		for _, global := range globalFlags {
+			if cmd == nil || !(global.name == "--list" || global.name == "--version" || global.name == "--stdio" || global.name == "--help") {
+				candidates = append(candidates, candidate{global.name, global.summary})
+			}
+		}
+		return candidates
+	}
+	fs.VisitAll(func(f *flag.Flag) {
+		_, usage := flag.UnquoteUsage(f)
+		candidates = append(candidates, candidate{"--" + f.Name, usage})
+	})
+	return candidates
+}
+
+// flagValues completes the value of a flag that takes one.
+func (c *cli) flagValues(name string) []candidate {
+	switch strings.TrimLeft(name, "-") {
+	case "backend":
+		var candidates []candidate
+		for _, backend := range imswitch.BackendNames() {
+			candidates = append(candidates, candidate{value: backend})
+		}
+		return candidates
+	case "input", "default":
+		return c.sourceCandidates()
+	case "format":
+		return []candidate{
+			{"short", "upper-case language, e.g. EN"},
+			{"long", "ID, kind, language and name"},
+			{"json", "same as --json"},
+		}
+	default:
+		return nil
+	}
+}
+
+// argumentCandidates completes the positional arguments of cmd.
+func (c *cli) argumentCandidates(cmd *command, positional int) []candidate {
+	switch cmd.name {
+	case "wait-for", "push":
+		if positional == 0 {
+			return c.sourceCandidates()
+		}
+	case "set", "toggle", "cycle":
+		return c.sourceCandidates()
+	case "restore":
+		if positional == 0 {
+			return slotCandidates()
+		}
+	case "completion":
+		if positional == 0 {
+			var candidates []candidate
+			for shell := range completionScripts {
+				candidates = append(candidates, candidate{value: shell})
+			}
+			sort.Slice(candidates, func(i, j int) bool { return candidates[i].value < candidates[j].value })
+			return candidates
+		}
+	case "help":
+		if positional == 0 {
+			var candidates []candidate
+			for _, command := range commands {
+				if !hiddenCommand(command.name) {
+					candidates = append(candidates, candidate{command.name, command.summary})
+				}
+			}
+			return candidates
+		}
+	}
+	return nil
+}
+
+// sourceCandidates lists the backend's input sources, described by their
+// display names, followed by the aliases from the config file. Errors yield
+// no candidates.
+func (c *cli) sourceCandidates() []candidate {
+	sources, err := c.opts.switcher().List(context.Background())
+	if err != nil {
+		return nil
+	}
+	candidates := make([]candidate, 0, len(sources))
+	for _, source := range sources {
+		candidates = append(candidates, candidate{source.ID, source.Name})
+	}
+
+	cfg, _ := loadConfig()
+	aliases := make([]candidate, 0, len(cfg.Aliases))
+	for alias, id := range cfg.Aliases {
+		aliases = append(aliases, candidate{alias, "alias for " + id})
+	}
+	sort.Slice(aliases, func(i, j int) bool { return aliases[i].value < aliases[j].value })
+	return append(candidates, aliases...)
+}
+
+// slotCandidates lists the slots saved with `im-switch save`. The state file
+// is replaced atomically, so it is read without taking the lock.
+func slotCandidates() []candidate {
+	dir, err := stateDir()
+	if err != nil {
+		return nil
+	}
+	state, err := (&stateStore{path: filepath.Join(dir, "state.json")}).load()
+	if err != nil {
+		return nil
+	}
+	var candidates []candidate
+	for slot, saved := range state.Slots {
+		candidates = append(candidates, candidate{slot, saved.ID})
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].value < candidates[j].value })
+	return candidates
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestComplete(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	useMemBackend(t)
+	if code, _, stderr := runCLI("save", "work"); code != exitOK {
+		t.Fatalf("save work = %d (stderr: %q)", code, stderr)
+	}
+
+	testCases := []struct {
+		words    []string
+		expected []string
+	}{
+		{[]string{"se"}, []string{"set", "serve"}},
+		{[]string{"set"}, []string{"set"}},
+		{[]string{"k"}, []string{"kr"}},
+		{[]string{"set", ""}, []string{"us", "kr", "de"}},
+		{[]string{"set", "us", ""}, []string{"us", "kr", "de"}},
+		{[]string{"push", "us", ""}, nil},
+		{[]string{"toggle", "us", "k"}, []string{"kr"}},
+		{[]string{"--json", "wait-for", "d"}, []string{"de"}},
+		{[]string{"list", "--l"}, []string{"--long"}},
+		{[]string{"--b"}, []string{"--backend"}},
+		{[]string{"--backend", "te"}, []string{"test"}},
+		{[]string{"exec", "--input", "k"}, []string{"kr"}},
+		{[]string{"exec", "--input", "kr", "--", ""}, nil},
+		{[]string{"doctor", "--default", "u"}, []string{"us"}},
+		{[]string{"restore", ""}, []string{"work"}},
+		{[]string{"completion", ""}, []string{"bash", "fish", "zsh"}},
+		{[]string{"help", "wa"}, []string{"wait-for", "watch"}},
+	}
+
+	for _, tc := range testCases {
+		code, stdout, stderr := runCLI(append([]string{"__complete"}, tc.words...)...)
+		if code != exitOK {
+			t.Errorf("__complete %q = %d (stderr: %q)", tc.words, code, stderr)
+			continue
+		}
+		var got []string
+		for _, line := range strings.Split(strings.TrimSuffix(stdout, "\n"), "\n") {
+			if line != "" {
+				value, _, _ := strings.Cut(line, "\t")
+				got = append(got, value)
+			}
+		}
+		if !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("__complete %q = %q, want %q", tc.words, got, tc.expected)
+		}
+	}
+}
+
+func TestCompleteDescriptions(t *testing.T) {
+	useMemBackend(t)
+
+	_, stdout, _ := runCLI("__complete", "set", "k")
+	if stdout != "kr\tTest kr\n" {
+		t.Errorf("__complete set k = %q, want the source name as description", stdout)
+	}
+
+	_, stdout, _ = runCLI("__complete", "")
+	if strings.Contains(stdout, "__complete") {
+		t.Errorf("__complete should not offer itself: %q", stdout)
+	}
+}
+
+func TestFishCompletionPassesCurrentToken(t *testing.T) {
+	// (commandline -ct) expands to no argument at all when the token is
+	// empty, which would complete the previous word instead.
+	if !strings.Contains(completionScripts["fish"], `"$current"`) {
+		t.Errorf("fish script should pass the current token quoted:\n%s", completionScripts["fish"])
+	}
+}
+
+func TestRunCompletion(t *testing.T) {
+	for shell := range completionScripts {
+		code, stdout, _ := runCLI("completion", shell)
+		if code != exitOK || !strings.Contains(stdout, "im-switch __complete") {
+			t.Errorf("completion %s = %d, %q; want a script calling __complete", shell, code, stdout)
+		}
+	}
+	if code, _, _ := runCLI("completion", "tcsh"); code != exitUsage {
+		t.Errorf("completion tcsh = %d, want %d", code, exitUsage)
+	}
+}
+
+// TestCompletionScripts runs the scripts in the shells that are installed,
+// with a stand-in im-switch that offers "argc<n>" for the n arguments it got.
+func TestCompletionScripts(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("completion scripts need a Unix shell")
+	}
+	dir := t.TempDir()
+	stub := "#!/bin/sh\necho \"argc$#\"\n"
+	if err := os.WriteFile(filepath.Join(dir, "im-switch"), []byte(stub), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	testCases := []struct {
+		shell string
+		// run loads the script from the file in its first argument and
+		// completes the line in its second. bash takes $0 before them.
+		run  string
+		args []string
+	}{
+		{"bash", `source "$1"; COMP_LINE="$2"; COMP_POINT=${#COMP_LINE}; _im_switch; printf '%s\n' "${COMPREPLY[@]}"`, []string{"bash"}},
+		{"fish", `source $argv[1]; complete -C"$argv[2]"`, nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.shell, func(t *testing.T) {
+			shell, err := exec.LookPath(tc.shell)
+			if err != nil {
+				t.Skipf("%s is not installed", tc.shell)
+			}
+			script := filepath.Join(t.TempDir(), "im-switch."+tc.shell)
+			if err := os.WriteFile(script, []byte(completionScripts[tc.shell]), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			// "__complete", "set" and the empty word being completed.
+			args := append([]string{"-c", tc.run}, tc.args...)
+			output, err := exec.Command(shell, append(args, script, "im-switch set ")...).Output()
+			if err != nil {
+				t.Fatalf("%s completion failed: %v", tc.shell, err)
+			}
+			if got := strings.TrimSpace(string(output)); got != "argc3" {
+				t.Errorf("%s completion of 'im-switch set ' = %q, want the empty word passed on (argc3)", tc.shell, got)
+			}
+		})
+	}
+}
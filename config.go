@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// configEnvVar names the environment variable that overrides the config
+// file location.
+const configEnvVar = "IM_SWITCH_CONFIG"
+
+// config is the optional user configuration read from config.json.
+type config struct {
+	// Ring is the list of input source IDs that `cycle` rotates through.
+	Ring []string `json:"ring,omitempty"`
+	// Default is the input source the editor switches to, checked by
+	// `doctor`.
+	Default string `json:"default,omitempty"`
+	// Aliases maps names of the user's choosing to input source IDs, e.g.
+	// "ko" to "hangul".
+	Aliases map[string]string `json:"aliases,omitempty"`
+}
+
+// configPath returns the location of the config file: $IM_SWITCH_CONFIG, or
+// im-switch/config.json under the user config directory.
+func configPath() (string, error) {
+	if path := os.Getenv(configEnvVar); path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "im-switch", "config.json"), nil
+}
+
+// loadConfig reads the config file. A missing file is not an error and
+// yields an empty config.
+func loadConfig() (config, error) {
+	var cfg config
+	path, err := configPath()
+	if err != nil {
+		return cfg, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, err
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("invalid config file %s: %v", path, err)
+	}
+	return cfg, nil
+}
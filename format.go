@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+	"time"
+
+	"github.com/chojs23/im-switch/imswitch"
+)
+
+// formatUsage is the help text of the --format flag.
+const formatUsage = "print each source with a Go `template`, or a preset: short, long or json"
+
+// formatPresets are the named formats accepted by --format. The json preset
+// is handled separately since it shares the --json output.
+var formatPresets = map[string]string{
+	"short": "{{short .}}",
+	"long":  "{{.ID}}\t{{or .Kind \"-\"}}\t{{or .Language \"-\"}}\t{{or .Name \"-\"}}",
+}
+
+// formatFuncs are the functions available to --format templates.
+var formatFuncs = template.FuncMap{
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"short": shortLabel,
+	"flag":  flagEmoji,
+}
+
+// formatData is what a --format template is executed with: the fields of
+// the input source, plus whether it is the current one and, for watch, when
+// it became active.
+type formatData struct {
+	imswitch.InputSource
+	Current bool
+	Time    time.Time
+}
+
+// sourceFormat prints input sources for --format.
+type sourceFormat struct {
+	name string
+	tmpl *template.Template
+	json bool
+}
+
+// parseFormat parses the value of --format. An empty value yields nil.
+func parseFormat(value string) (*sourceFormat, error) {
+	switch value {
+	case "":
+		return nil, nil
+	case "json":
+		return &sourceFormat{name: value, json: true}, nil
+	}
+
+	text, preset := formatPresets[value]
+	if !preset {
+		text = value
+	}
+	tmpl, err := template.New("format").Funcs(formatFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --format: %v", err)
+	}
+	// Field names are only checked when the template runs, so run it once
+	// to report unknown ones up front. Other errors, such as an index out of
+	// range, depend on the source and are left to the real run.
+	if err := tmpl.Execute(io.Discard, formatData{}); err != nil && strings.Contains(err.Error(), "can't evaluate field") {
+		return nil, fmt.Errorf("invalid --format: %v", err)
+	}
+	if !preset {
+		value = ""
+	}
+	return &sourceFormat{name: value, tmpl: tmpl}, nil
+}
+
+// formatFlag parses the --format value given to a command and reconciles it
+// with --json. It reports a usage error and returns ok=false when they
+// conflict or the template is invalid.
+func (c *cli) formatFlag(value string) (format *sourceFormat, code int, ok bool) {
+	format, err := parseFormat(value)
+	if err != nil {
+		return nil, c.usageError(err.Error()), false
+	}
+	switch {
+	case format == nil:
+		return nil, exitOK, true
+	case format.json:
+		// Errors are then reported as JSON as well.
+		c.opts.json = true
+		return nil, exitOK, true
+	case c.opts.json:
+		return nil, c.usageError("--format cannot be combined with --json"), false
+	}
+	return format, exitOK, true
+}
+
+// write prints one line per entry of data.
+func (f *sourceFormat) write(w io.Writer, data ...formatData) error {
+	if f.name == "long" {
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		defer tw.Flush()
+		w = tw
+	}
+	for _, d := range data {
+		if err := f.tmpl.Execute(w, d); err != nil {
+			return err
+		}
+		fmt.Fprintln(w)
+	}
+	return nil
+}
+
+// shortLabel returns the upper-case base language of source, e.g. "EN" or
+// "KO", or its ID when the language is unknown.
+func shortLabel(source formatData) string {
+	if source.Language == "" {
+		return source.ID
+	}
+	base, _, _ := strings.Cut(source.Language, "-")
+	return strings.ToUpper(base)
+}
+
+// defaultRegions picks the flag shown for a language tag without a region.
+var defaultRegions = map[string]string{
+	"en": "US",
+	"ko": "KR",
+	"ja": "JP",
+	"zh": "CN",
+	"de": "DE",
+	"fr": "FR",
+	"es": "ES",
+	"it": "IT",
+	"ru": "RU",
+	"vi": "VN",
+}
+
+// flagEmoji returns the flag of the region of a language tag such as
+// "zh-TW", or of the usual region of a bare language such as "ko". It
+// returns "" when no region is known.
+func flagEmoji(language string) string {
+	base, region, _ := strings.Cut(language, "-")
+	if region == "" {
+		region = defaultRegions[strings.ToLower(base)]
+	}
+	region = strings.ToUpper(region)
+	if len(region) != 2 || region[0] < 'A' || region[0] > 'Z' || region[1] < 'A' || region[1] > 'Z' {
+		return ""
+	}
+	const regionalIndicatorA = 0x1F1E6
+	return string([]rune{regionalIndicatorA + rune(region[0]-'A'), regionalIndicatorA + rune(region[1]-'A')})
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/chojs23/im-switch/imswitch"
+)
+
+func TestFlagEmoji(t *testing.T) {
+	testCases := []struct {
+		language string
+		expected string
+	}{
+		{"ko", "🇰🇷"},
+		{"en", "🇺🇸"},
+		{"en-GB", "🇬🇧"},
+		{"zh-TW", "🇹🇼"},
+		{"ZH", "🇨🇳"},
+		{"tlh", ""},
+		{"", ""},
+		{"sr-Latn", ""},
+	}
+
+	for _, tc := range testCases {
+		if got := flagEmoji(tc.language); got != tc.expected {
+			t.Errorf("flagEmoji(%q) = %q, want %q", tc.language, got, tc.expected)
+		}
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	testCases := []struct {
+		value string
+		valid bool
+	}{
+		{"{{.ID}}", true},
+		{"short", true},
+		{"{{slice .ID 0 2}}", true},
+		{"{{index .Name 0}}", true},
+		{"{{.Flag}}", false},
+		{"{{.ID", false},
+		{"{{nope .ID}}", false},
+	}
+
+	for _, tc := range testCases {
+		if _, err := parseFormat(tc.value); (err == nil) != tc.valid {
+			t.Errorf("parseFormat(%q) = %v, want valid %v", tc.value, err, tc.valid)
+		}
+	}
+}
+
+func TestShortLabel(t *testing.T) {
+	testCases := []struct {
+		source   imswitch.InputSource
+		expected string
+	}{
+		{imswitch.InputSource{ID: "hangul", Language: "ko"}, "KO"},
+		{imswitch.InputSource{ID: "xkb:us::eng", Language: "en-US"}, "EN"},
+		{imswitch.InputSource{ID: "custom"}, "custom"},
+	}
+
+	for _, tc := range testCases {
+		if got := shortLabel(formatData{InputSource: tc.source}); got != tc.expected {
+			t.Errorf("shortLabel(%+v) = %q, want %q", tc.source, got, tc.expected)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package imswitch
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// BackendEnvVar names the environment variable that forces a backend.
+const BackendEnvVar = "IM_SWITCH_BACKEND"
+
+// Backend is an input method framework that can report and switch input sources.
+type Backend interface {
+	// Name returns the identifier used to select the backend (e.g. "ibus").
+	Name() string
+	// Available reports whether the backend's tooling is present on this system.
+	Available() bool
+	// Current returns the active input source ID.
+	Current(ctx context.Context) (string, error)
+	// List returns all input sources known to the backend.
+	List(ctx context.Context) ([]InputSource, error)
+	// Set switches to the given input source ID.
+	Set(ctx context.Context, sourceID string) error
+}
+
+// PartialLister is implemented by backends whose List is a sample rather
+// than everything Set accepts. The XKB backend, for one, lists common
+// layouts, while setxkbmap takes others such as "dvorak" or "us(intl)".
+type PartialLister interface {
+	// PartialList reports whether Set accepts sources that List leaves out.
+	PartialList() bool
+}
+
+type registeredBackend struct {
+	backend  Backend
+	priority int
+}
+
+var backends []registeredBackend
+
+// Register adds a backend to the registry. Backends with a lower
+// priority value are preferred when several are available.
+func Register(b Backend, priority int) {
+	for i, rb := range backends {
+		if rb.backend.Name() == b.Name() {
+			backends[i] = registeredBackend{backend: b, priority: priority}
+			sortBackends()
+			return
+		}
+	}
+	backends = append(backends, registeredBackend{backend: b, priority: priority})
+	sortBackends()
+}
+
+func sortBackends() {
+	sort.SliceStable(backends, func(i, j int) bool {
+		return backends[i].priority < backends[j].priority
+	})
+}
+
+// Backends returns all registered backends in priority order.
+func Backends() []Backend {
+	result := make([]Backend, 0, len(backends))
+	for _, rb := range backends {
+		result = append(result, rb.backend)
+	}
+	return result
+}
+
+// Lookup returns the registered backend with the given name, or nil.
+func Lookup(name string) Backend {
+	for _, rb := range backends {
+		if rb.backend.Name() == name {
+			return rb.backend
+		}
+	}
+	return nil
+}
+
+// BackendNames returns the names of all registered backends in priority order.
+func BackendNames() []string {
+	names := make([]string, 0, len(backends))
+	for _, rb := range backends {
+		names = append(names, rb.backend.Name())
+	}
+	return names
+}
+
+// activeBackend returns the backend for the detected input method framework.
+// Detection that could not finish, e.g. because ctx timed out, returns an
+// error instead of settling for whichever backend a later probe found.
+func activeBackend(ctx context.Context) (Backend, error) {
+	name, err := detectInputMethod(ctx)
+	if err != nil {
+		return nil, commandFailure("", "", err)
+	}
+	return Lookup(name), nil
+}
+
+// ErrNoBackendDetected is returned when detection finds no usable framework.
+var ErrNoBackendDetected = &Error{Kind: ErrBackendUnavailable, Detail: "no input method framework detected"}
+
+// backendOverride returns the explicitly requested backend name, falling back
+// to the IM_SWITCH_BACKEND environment variable.
+func backendOverride(name string) string {
+	if name == "" {
+		name = os.Getenv(BackendEnvVar)
+	}
+	return name
+}
+
+// resolveBackend returns the named backend, or the one named by the
+// IM_SWITCH_BACKEND environment variable, bypassing detection. When neither
+// is set, the detected backend is returned.
+func resolveBackend(ctx context.Context, name string) (Backend, error) {
+	name = backendOverride(name)
+	if name == "" {
+		backend, err := activeBackend(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if backend != nil {
+			return backend, nil
+		}
+		return nil, ErrNoBackendDetected
+	}
+
+	backend := Lookup(name)
+	if backend == nil {
+		return nil, &Error{
+			Kind:    ErrBackendUnavailable,
+			Backend: name,
+			Detail:  fmt.Sprintf("unknown backend (supported: %s)", strings.Join(BackendNames(), ", ")),
+		}
+	}
+	if !backend.Available() {
+		return nil, &Error{Kind: ErrBackendUnavailable, Backend: name, Detail: "not available on this system"}
+	}
+	return backend, nil
+}
@@ -0,0 +1,149 @@
+package imswitch
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// stubBackend is an in-memory Backend for registry and Switcher tests.
+type stubBackend struct {
+	name        string
+	unavailable bool
+	current     string
+	sources     []string
+	// hang makes Current block until its context is done.
+	hang bool
+}
+
+func (b stubBackend) Name() string    { return b.name }
+func (b stubBackend) Available() bool { return !b.unavailable }
+
+func (b stubBackend) Current(ctx context.Context) (string, error) {
+	if b.hang {
+		<-ctx.Done()
+		return "", commandFailure(b.name, "", ctx.Err())
+	}
+	return b.current, nil
+}
+
+func (b stubBackend) List(ctx context.Context) ([]InputSource, error) {
+	var sources []InputSource
+	for _, id := range b.sources {
+		sources = append(sources, InputSource{ID: id, Name: "Stub " + id, Backend: b.name})
+	}
+	return sources, nil
+}
+
+func (b stubBackend) Set(ctx context.Context, sourceID string) error {
+	sources, _ := b.List(ctx)
+	return unknownSource(b.name, sourceID, sources)
+}
+
+func withBackends(t *testing.T) {
+	saved := backends
+	backends = nil
+	t.Cleanup(func() { backends = saved })
+}
+
+func TestRegisterBackendOrdersByPriority(t *testing.T) {
+	withBackends(t)
+
+	Register(stubBackend{name: "low"}, 50)
+	Register(stubBackend{name: "high"}, 10)
+	Register(stubBackend{name: "mid"}, 20)
+
+	expected := []string{"high", "mid", "low"}
+	registered := Backends()
+	if len(registered) != len(expected) {
+		t.Fatalf("Expected %d backends, got %d", len(expected), len(registered))
+	}
+	for i, name := range expected {
+		if registered[i].Name() != name {
+			t.Errorf("Expected backend %s at index %d, got %s", name, i, registered[i].Name())
+		}
+	}
+}
+
+func TestRegisterBackendReplacesSameName(t *testing.T) {
+	withBackends(t)
+
+	Register(stubBackend{name: "a"}, 10)
+	Register(stubBackend{name: "b"}, 20)
+	Register(stubBackend{name: "a"}, 30)
+
+	registered := Backends()
+	if len(registered) != 2 {
+		t.Fatalf("Expected 2 backends, got %d", len(registered))
+	}
+	if registered[0].Name() != "b" || registered[1].Name() != "a" {
+		t.Errorf("Unexpected order after re-registering: %s, %s", registered[0].Name(), registered[1].Name())
+	}
+}
+
+func TestLookupBackend(t *testing.T) {
+	withBackends(t)
+
+	Register(stubBackend{name: "a"}, 10)
+
+	if Lookup("a") == nil {
+		t.Error("Lookup() should find a registered backend")
+	}
+	if Lookup("missing") != nil {
+		t.Error("Lookup() should return nil for an unknown backend")
+	}
+}
+
+func TestResolveBackendByName(t *testing.T) {
+	withBackends(t)
+	t.Setenv(BackendEnvVar, "")
+
+	Register(stubBackend{name: "a"}, 10)
+	Register(stubBackend{name: "b"}, 20)
+
+	backend, err := resolveBackend(context.Background(), "b")
+	if err != nil {
+		t.Fatalf("resolveBackend(context.Background(), ) returned error: %v", err)
+	}
+	if backend.Name() != "b" {
+		t.Errorf("Expected backend b, got %s", backend.Name())
+	}
+}
+
+func TestResolveBackendFromEnv(t *testing.T) {
+	withBackends(t)
+	t.Setenv(BackendEnvVar, "b")
+
+	Register(stubBackend{name: "a"}, 10)
+	Register(stubBackend{name: "b"}, 20)
+
+	backend, err := resolveBackend(context.Background(), "")
+	if err != nil {
+		t.Fatalf("resolveBackend(context.Background(), ) returned error: %v", err)
+	}
+	if backend.Name() != "b" {
+		t.Errorf("Expected backend b from %s, got %s", BackendEnvVar, backend.Name())
+	}
+
+	backend, err = resolveBackend(context.Background(), "a")
+	if err != nil {
+		t.Fatalf("resolveBackend(context.Background(), ) returned error: %v", err)
+	}
+	if backend.Name() != "a" {
+		t.Errorf("Flag should take precedence over %s, got %s", BackendEnvVar, backend.Name())
+	}
+}
+
+func TestResolveBackendErrors(t *testing.T) {
+	withBackends(t)
+	t.Setenv(BackendEnvVar, "")
+
+	Register(stubBackend{name: "down", unavailable: true}, 10)
+
+	if _, err := resolveBackend(context.Background(), "missing"); !errors.Is(err, ErrBackendUnavailable) {
+		t.Errorf("resolveBackend(context.Background(), ) should fail with ErrBackendUnavailable for an unknown backend, got %v", err)
+	}
+	if _, err := resolveBackend(context.Background(), "down"); !errors.Is(err, ErrBackendUnavailable) {
+		t.Errorf("resolveBackend(context.Background(), ) should fail with ErrBackendUnavailable for an unavailable backend, got %v", err)
+	}
+}
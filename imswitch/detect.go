@@ -0,0 +1,75 @@
+package imswitch
+
+import (
+	"fmt"
+)
+
+// DetectionReport records how a backend was chosen so that detection can be
+// explained to the user.
+type DetectionReport struct {
+	Selected string             `json:"selected"`
+	Override string             `json:"override,omitempty"`
+	Probes   []ProbeReport      `json:"probes"`
+	Rejected []BackendRejection `json:"rejected"`
+}
+
+// ProbeReport lists what a single detection probe looked at and what it
+// concluded. Result is empty when the probe deferred to the next one.
+type ProbeReport struct {
+	Name         string   `json:"name"`
+	Observations []string `json:"observations"`
+	Result       string   `json:"result,omitempty"`
+}
+
+// BackendRejection explains why a backend was not selected.
+type BackendRejection struct {
+	Backend string `json:"backend"`
+	Reason  string `json:"reason"`
+}
+
+func (r *DetectionReport) beginProbe(name string) {
+	r.Probes = append(r.Probes, ProbeReport{Name: name, Observations: []string{}})
+}
+
+func (r *DetectionReport) observe(format string, args ...any) {
+	if len(r.Probes) == 0 {
+		r.beginProbe("")
+	}
+	probe := &r.Probes[len(r.Probes)-1]
+	probe.Observations = append(probe.Observations, fmt.Sprintf(format, args...))
+}
+
+func (r *DetectionReport) reject(backend, format string, args ...any) {
+	for _, rejection := range r.Rejected {
+		if rejection.Backend == backend {
+			return
+		}
+	}
+	r.Rejected = append(r.Rejected, BackendRejection{Backend: backend, Reason: fmt.Sprintf(format, args...)})
+}
+
+// finish records the selected backend and a rejection reason for every other
+// registered backend that no probe has already explained.
+func (r *DetectionReport) finish(selected string) {
+	r.Selected = selected
+	if len(r.Probes) > 0 && selected != "" {
+		r.Probes[len(r.Probes)-1].Result = selected
+	}
+
+	for _, backend := range Backends() {
+		name := backend.Name()
+		if name == selected {
+			continue
+		}
+		if !backend.Available() {
+			r.reject(name, "not available on this system")
+		} else if selected != "" {
+			r.reject(name, "available, but %s was selected", selected)
+		} else {
+			r.reject(name, "available, but no probe selected it")
+		}
+	}
+	if r.Rejected == nil {
+		r.Rejected = []BackendRejection{}
+	}
+}
@@ -0,0 +1,212 @@
+//go:build linux
+
+package imswitch
+
+import (
+	"context"
+	"os"
+	"strings"
+)
+
+// A detectionProbe inspects one aspect of the environment and returns the
+// name of the backend it points at, or "" to defer to the next probe. An
+// error, such as ctx running out, stops detection.
+type detectionProbe struct {
+	name string
+	run  func(ctx context.Context, r *DetectionReport) (string, error)
+}
+
+// detectionProbes is evaluated in order; the first probe that names an
+// available backend wins.
+var detectionProbes = []detectionProbe{
+	{"env", detectFromEnv},
+	{"daemon", detectFromDaemons},
+	{"session", detectFromSession},
+	{"tools", detectFromTools},
+}
+
+// imEnvVars are consulted in order by the env probe. INPUT_METHOD is an
+// explicit user choice, XMODIFIERS uses the "@im=<name>" form.
+var imEnvVars = []string{"INPUT_METHOD", "GTK_IM_MODULE", "QT_IM_MODULE", "XMODIFIERS"}
+
+// detectInputMethod detects which input method framework is running
+func detectInputMethod(ctx context.Context) (string, error) {
+	report, err := explain(ctx)
+	return report.Selected, err
+}
+
+// explain runs the probe chain and records what each probe saw. A probe that
+// fails ends detection with its error, since a timed out check is not the
+// same as a framework that is not running.
+func explain(ctx context.Context) (DetectionReport, error) {
+	var report DetectionReport
+	for _, probe := range detectionProbes {
+		report.beginProbe(probe.name)
+		name, err := probe.run(ctx, &report)
+		if err != nil {
+			report.observe("%v", err)
+			report.finish("")
+			return report, err
+		}
+		if name != "" {
+			report.finish(name)
+			return report, nil
+		}
+	}
+	report.finish("")
+	return report, nil
+}
+
+// usableBackend returns name if the backend is registered and available,
+// otherwise it records why the backend was passed over.
+func usableBackend(r *DetectionReport, name, reason string) string {
+	backend := Lookup(name)
+	if backend == nil {
+		r.reject(name, "%s, but no such backend is compiled in", reason)
+		return ""
+	}
+	if !backend.Available() {
+		r.reject(name, "%s, but its tools are not installed", reason)
+		return ""
+	}
+	return name
+}
+
+func detectFromEnv(ctx context.Context, r *DetectionReport) (string, error) {
+	for _, key := range imEnvVars {
+		value := os.Getenv(key)
+		if value == "" {
+			r.observe("%s is not set", key)
+			continue
+		}
+		r.observe("%s=%s", key, value)
+
+		family := frameworkFromEnvValue(value)
+		if family == "" {
+			continue
+		}
+		if family == "fcitx" {
+			fcitx5Running, err := isProcessRunning(ctx, "fcitx5")
+			if err != nil {
+				return "", err
+			}
+			fcitxRunning, err := isProcessRunning(ctx, "fcitx")
+			if err != nil {
+				return "", err
+			}
+			hasFcitx5Remote := hasCommand("fcitx5-remote")
+			family = resolveFcitxVersion(fcitx5Running, fcitxRunning, hasFcitx5Remote)
+			r.observe("fcitx5 running: %t, fcitx running: %t, fcitx5-remote on PATH: %t => %s",
+				fcitx5Running, fcitxRunning, hasFcitx5Remote, family)
+		}
+		if name := usableBackend(r, family, key+" points at "+family); name != "" {
+			return name, nil
+		}
+	}
+	return "", nil
+}
+
+// frameworkFromEnvValue maps an IM module variable such as GTK_IM_MODULE or
+// XMODIFIERS to a framework name. A bare "fcitx" is ambiguous between fcitx
+// and fcitx5 and is returned as "fcitx" for the caller to resolve.
+func frameworkFromEnvValue(value string) string {
+	value = strings.ToLower(strings.TrimSpace(value))
+	value = strings.TrimPrefix(value, "@im=")
+
+	switch {
+	case value == "":
+		return ""
+	case strings.Contains(value, "ibus"):
+		return "ibus"
+	case strings.Contains(value, "fcitx5"):
+		return "fcitx5"
+	case strings.Contains(value, "fcitx"):
+		return "fcitx"
+	case value == "xim" || value == "none":
+		return "xkb"
+	default:
+		return ""
+	}
+}
+
+// resolveFcitxVersion tells fcitx and fcitx5 apart, since fcitx5 still
+// advertises itself as "fcitx" in GTK_IM_MODULE and QT_IM_MODULE.
+func resolveFcitxVersion(fcitx5Running, fcitxRunning, hasFcitx5Remote bool) string {
+	switch {
+	case fcitx5Running:
+		return "fcitx5"
+	case fcitxRunning:
+		return "fcitx"
+	case hasFcitx5Remote:
+		return "fcitx5"
+	default:
+		return "fcitx"
+	}
+}
+
+func detectFromDaemons(ctx context.Context, r *DetectionReport) (string, error) {
+	daemons := []struct {
+		process string
+		backend string
+	}{
+		{"ibus-daemon", "ibus"},
+		{"fcitx5", "fcitx5"},
+		{"fcitx", "fcitx"},
+	}
+
+	for _, d := range daemons {
+		running, err := isProcessRunning(ctx, d.process)
+		if err != nil {
+			return "", err
+		}
+		if !running {
+			r.observe("%s is not running", d.process)
+			continue
+		}
+		r.observe("%s is running", d.process)
+		if name := usableBackend(r, d.backend, d.process+" is running"); name != "" {
+			return name, nil
+		}
+	}
+	return "", nil
+}
+
+// detectFromSession falls back to XKB on X11 sessions without an IM daemon.
+func detectFromSession(ctx context.Context, r *DetectionReport) (string, error) {
+	session := sessionType()
+	if session == "" {
+		r.observe("session type is unknown")
+		return "", nil
+	}
+	r.observe("session type is %s", session)
+	if session == "x11" {
+		return usableBackend(r, "xkb", "X11 session"), nil
+	}
+	return "", nil
+}
+
+// sessionType returns "x11", "wayland", "tty" or "" when it cannot be told.
+func sessionType() string {
+	if t := strings.ToLower(os.Getenv("XDG_SESSION_TYPE")); t != "" {
+		return t
+	}
+	if os.Getenv("WAYLAND_DISPLAY") != "" {
+		return "wayland"
+	}
+	if os.Getenv("DISPLAY") != "" {
+		return "x11"
+	}
+	return ""
+}
+
+// detectFromTools picks the highest priority backend whose tooling is installed.
+func detectFromTools(ctx context.Context, r *DetectionReport) (string, error) {
+	for _, backend := range Backends() {
+		if backend.Available() {
+			r.observe("%s tools are installed", backend.Name())
+			return backend.Name(), nil
+		}
+		r.observe("%s tools are not installed", backend.Name())
+	}
+	return "", nil
+}
@@ -0,0 +1,77 @@
+//go:build linux
+
+package imswitch
+
+import (
+	"testing"
+)
+
+func TestFrameworkFromEnvValue(t *testing.T) {
+	testCases := []struct {
+		value    string
+		expected string
+	}{
+		{"", ""},
+		{"ibus", "ibus"},
+		{"IBus", "ibus"},
+		{"fcitx", "fcitx"},
+		{"fcitx5", "fcitx5"},
+		{"@im=fcitx", "fcitx"},
+		{"@im=ibus", "ibus"},
+		{"xim", "xkb"},
+		{"gtk-im-context-simple", ""},
+	}
+
+	for _, tc := range testCases {
+		if got := frameworkFromEnvValue(tc.value); got != tc.expected {
+			t.Errorf("frameworkFromEnvValue(%q) = %q, want %q", tc.value, got, tc.expected)
+		}
+	}
+}
+
+func TestResolveFcitxVersion(t *testing.T) {
+	testCases := []struct {
+		fcitx5Running   bool
+		fcitxRunning    bool
+		hasFcitx5Remote bool
+		expected        string
+	}{
+		{true, false, true, "fcitx5"},
+		{true, true, false, "fcitx5"},
+		{false, true, true, "fcitx"},
+		{false, false, true, "fcitx5"},
+		{false, false, false, "fcitx"},
+	}
+
+	for _, tc := range testCases {
+		got := resolveFcitxVersion(tc.fcitx5Running, tc.fcitxRunning, tc.hasFcitx5Remote)
+		if got != tc.expected {
+			t.Errorf("resolveFcitxVersion(%v, %v, %v) = %q, want %q",
+				tc.fcitx5Running, tc.fcitxRunning, tc.hasFcitx5Remote, got, tc.expected)
+		}
+	}
+}
+
+func TestSessionType(t *testing.T) {
+	testCases := []struct {
+		sessionType    string
+		waylandDisplay string
+		display        string
+		expected       string
+	}{
+		{"x11", "", "", "x11"},
+		{"Wayland", "", ":0", "wayland"},
+		{"", "wayland-0", ":0", "wayland"},
+		{"", "", ":0", "x11"},
+		{"", "", "", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Setenv("XDG_SESSION_TYPE", tc.sessionType)
+		t.Setenv("WAYLAND_DISPLAY", tc.waylandDisplay)
+		t.Setenv("DISPLAY", tc.display)
+		if got := sessionType(); got != tc.expected {
+			t.Errorf("sessionType() = %q, want %q", got, tc.expected)
+		}
+	}
+}
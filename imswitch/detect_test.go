@@ -0,0 +1,40 @@
+package imswitch
+
+import (
+	"testing"
+)
+
+func TestDetectionReportFinish(t *testing.T) {
+	withBackends(t)
+
+	Register(stubBackend{name: "first"}, 10)
+	Register(stubBackend{name: "second"}, 20)
+	Register(stubBackend{name: "down", unavailable: true}, 30)
+
+	var report DetectionReport
+	report.beginProbe("env")
+	report.observe("GTK_IM_MODULE=%s", "second")
+	report.reject("first", "explained by probe")
+	report.finish("second")
+
+	if report.Selected != "second" {
+		t.Errorf("Expected selected backend second, got %s", report.Selected)
+	}
+	if report.Probes[0].Result != "second" {
+		t.Errorf("Expected the last probe to record the result, got %q", report.Probes[0].Result)
+	}
+
+	reasons := map[string]string{}
+	for _, rejection := range report.Rejected {
+		reasons[rejection.Backend] = rejection.Reason
+	}
+	if len(reasons) != 2 {
+		t.Fatalf("Expected 2 rejected backends, got %v", report.Rejected)
+	}
+	if reasons["first"] != "explained by probe" {
+		t.Errorf("Probe rejection should not be overwritten, got %q", reasons["first"])
+	}
+	if reasons["down"] != "not available on this system" {
+		t.Errorf("Unexpected reason for unavailable backend: %q", reasons["down"])
+	}
+}
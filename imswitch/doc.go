@@ -0,0 +1,17 @@
+// Package imswitch reads and switches the keyboard input source.
+//
+// Input method frameworks are implemented as Backends that register
+// themselves for the current platform: the Text Input Source APIs on macOS,
+// the IME on Windows, and IBus, Fcitx, Fcitx5 or XKB on Linux. A Switcher
+// picks one of them, either by name or by detection, and exposes Current,
+// List and Set:
+//
+//	s := imswitch.New(imswitch.WithTimeout(time.Second))
+//	current, err := s.Current(ctx)
+//	if err == nil && current != "xkb:us::eng" {
+//		err = s.Set(ctx, "xkb:us::eng")
+//	}
+//
+// Errors returned by backends wrap one of the Err* sentinels and can be
+// tested with errors.Is.
+package imswitch
@@ -0,0 +1,82 @@
+package imswitch
+
+import (
+	"context"
+	"fmt"
+)
+
+// CheckStatus is the outcome of a health check.
+type CheckStatus string
+
+const (
+	CheckPass CheckStatus = "pass"
+	CheckWarn CheckStatus = "warn"
+	CheckFail CheckStatus = "fail"
+)
+
+// Check is one finding reported by Diagnose.
+type Check struct {
+	Name    string      `json:"name"`
+	Status  CheckStatus `json:"status"`
+	Message string      `json:"message"`
+	// Advice suggests how to fix a warning or failure.
+	Advice string `json:"advice,omitempty"`
+}
+
+func passCheck(name, format string, args ...any) Check {
+	return Check{Name: name, Status: CheckPass, Message: fmt.Sprintf(format, args...)}
+}
+
+func warnCheck(name, advice, format string, args ...any) Check {
+	return Check{Name: name, Status: CheckWarn, Message: fmt.Sprintf(format, args...), Advice: advice}
+}
+
+func failCheck(name, advice, format string, args ...any) Check {
+	return Check{Name: name, Status: CheckFail, Message: fmt.Sprintf(format, args...), Advice: advice}
+}
+
+// Diagnose checks the environment for problems that break input switching
+// and exercises the Switcher's backend. When defaultSource is not empty, it
+// also checks that the backend lists it.
+func (s *Switcher) Diagnose(ctx context.Context, defaultSource string) []Check {
+	backend, err := s.Backend(ctx)
+	name := ""
+	if backend != nil {
+		name = backend.Name()
+	}
+	checks := platformChecks(ctx, name)
+	if err != nil {
+		return append(checks, failCheck("backend",
+			fmt.Sprintf("install a supported input method framework, or select one with --backend or %s", BackendEnvVar),
+			"%v", err))
+	}
+	checks = append(checks, passCheck("backend", "using %s", name))
+
+	current, err := s.Current(ctx)
+	if err != nil {
+		checks = append(checks, failCheck("current", "check that the input method daemon is running and responsive", "%v", err))
+	} else {
+		checks = append(checks, passCheck("current", "current source is %s", current))
+	}
+
+	sources, err := s.List(ctx)
+	switch {
+	case err != nil:
+		return append(checks, failCheck("list", "check that the input method daemon is running and responsive", "%v", err))
+	case len(sources) == 0:
+		checks = append(checks, warnCheck("list", "add input sources in your input method configuration", "%s lists no input sources", name))
+	default:
+		checks = append(checks, passCheck("list", "%s lists %d input sources", name, len(sources)))
+	}
+
+	if defaultSource != "" {
+		if _, ok := findSource(sources, defaultSource); ok {
+			checks = append(checks, passCheck("default", "default source %s is available", defaultSource))
+		} else {
+			checks = append(checks, warnCheck("default",
+				"use one of the IDs printed by 'im-switch list' as the default input",
+				"default source %s is not listed by %s", defaultSource, name))
+		}
+	}
+	return checks
+}
@@ -0,0 +1,149 @@
+//go:build linux
+
+package imswitch
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// imFramework is an input method framework that doctor inspects.
+type imFramework struct {
+	name string
+	// process is the daemon's exact process name; "fcitx" must not match
+	// a running fcitx5.
+	process string
+	tool    string
+}
+
+var imFrameworks = []imFramework{
+	{"ibus", "ibus-daemon", "ibus"},
+	{"fcitx5", "fcitx5", "fcitx5-remote"},
+	{"fcitx", "fcitx", "fcitx-remote"},
+}
+
+// imModuleVars are read by GTK, Qt and X applications to pick the input
+// method, so they have to agree with each other and the running daemon.
+var imModuleVars = []string{"GTK_IM_MODULE", "QT_IM_MODULE", "XMODIFIERS"}
+
+// platformChecks inspects installed and running frameworks, the IM module
+// variables and the session type. backend is the selected backend, if any.
+func platformChecks(ctx context.Context, backend string) []Check {
+	var installed, running, states []string
+	for _, f := range imFrameworks {
+		isInstalled := hasCommand(f.tool)
+		isRunning, err := isProcessRunning(ctx, f.process)
+		if err != nil {
+			return []Check{failCheck("frameworks",
+				"retry with a longer --timeout; the system may be under heavy load",
+				"checking whether %s is running: %v", f.process, err)}
+		}
+		switch {
+		case isRunning:
+			running = append(running, f.name)
+			states = append(states, f.name+" running")
+		case isInstalled:
+			states = append(states, f.name+" installed but not running")
+		default:
+			states = append(states, f.name+" not installed")
+		}
+		if isInstalled {
+			installed = append(installed, f.name)
+		}
+	}
+
+	checks := []Check{frameworkCheck(installed, running, states)}
+	if len(running) > 1 {
+		checks = append(checks, warnCheck("daemons",
+			"stop all but one input method daemon; they compete for the keyboard and applications may talk to either",
+			"%s are running at the same time", strings.Join(running, " and ")))
+	} else {
+		checks = append(checks, passCheck("daemons", "no conflicting input method daemons"))
+	}
+	checks = append(checks, envCheck(running))
+
+	if backend == "xkb" {
+		if session := sessionType(); session == "wayland" {
+			checks = append(checks, warnCheck("session",
+				"use IBus or Fcitx5, or switch layouts through your compositor's settings",
+				"setxkbmap only affects XWayland applications in a Wayland session"))
+		} else {
+			checks = append(checks, passCheck("session", "setxkbmap can switch layouts in this %s session", orUnknown(session)))
+		}
+	}
+	return checks
+}
+
+func frameworkCheck(installed, running, states []string) Check {
+	message := strings.Join(states, ", ")
+	switch {
+	case len(running) > 0:
+		return passCheck("frameworks", "%s", message)
+	case len(installed) > 0:
+		return warnCheck("frameworks",
+			"start the daemon, e.g. 'ibus-daemon -drx' or 'fcitx5 -d', or add it to your session's autostart",
+			"%s", message)
+	case hasCommand("setxkbmap"):
+		return passCheck("frameworks", "%s; only XKB layouts can be switched", message)
+	default:
+		return failCheck("frameworks", "install IBus, Fcitx5 or setxkbmap", "%s, and setxkbmap is not installed", message)
+	}
+}
+
+// envCheck verifies that the IM module variables name the same framework
+// and that it is running.
+func envCheck(running []string) Check {
+	var set, unset []string
+	families := map[string]bool{}
+	for _, key := range imModuleVars {
+		value := os.Getenv(key)
+		if value == "" {
+			unset = append(unset, key)
+			continue
+		}
+		set = append(set, key+"="+value)
+		if family := frameworkFromEnvValue(value); family != "" {
+			// fcitx5 still registers its modules as "fcitx".
+			families[strings.TrimSuffix(family, "5")] = true
+		}
+	}
+
+	const advice = "set GTK_IM_MODULE, QT_IM_MODULE and XMODIFIERS=@im=<name> to the running framework, e.g. in ~/.profile or /etc/environment"
+	switch {
+	case len(set) == 0 && len(running) > 0:
+		return warnCheck("environment", advice, "%s are not set, so applications may not use %s", strings.Join(unset, ", "), running[0])
+	case len(set) == 0:
+		return passCheck("environment", "no input method module variables are set")
+	case len(families) > 1:
+		return warnCheck("environment", advice, "the variables disagree: %s", strings.Join(set, ", "))
+	case len(unset) > 0 && len(running) > 0:
+		return warnCheck("environment", advice, "%s set, but %s not", strings.Join(set, ", "), strings.Join(unset, ", "))
+	}
+
+	for family := range families {
+		if family == "xkb" {
+			break
+		}
+		found := false
+		for _, name := range running {
+			if strings.TrimSuffix(name, "5") == family {
+				found = true
+			}
+		}
+		if !found {
+			return warnCheck("environment",
+				fmt.Sprintf("start %s, or point the variables at the framework that is running", family),
+				"%s, but %s is not running", strings.Join(set, ", "), family)
+		}
+	}
+	return passCheck("environment", "%s", strings.Join(set, ", "))
+}
+
+func orUnknown(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+	return s
+}
@@ -0,0 +1,133 @@
+//go:build linux
+
+package imswitch
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestEnvCheck(t *testing.T) {
+	testCases := []struct {
+		name     string
+		env      map[string]string
+		running  []string
+		expected CheckStatus
+	}{
+		{"nothing set or running", nil, nil, CheckPass},
+		{"unset with daemon", nil, []string{"ibus"}, CheckWarn},
+		{"consistent ibus", map[string]string{"GTK_IM_MODULE": "ibus", "QT_IM_MODULE": "ibus", "XMODIFIERS": "@im=ibus"}, []string{"ibus"}, CheckPass},
+		{"fcitx names match fcitx5", map[string]string{"GTK_IM_MODULE": "fcitx", "QT_IM_MODULE": "fcitx5", "XMODIFIERS": "@im=fcitx"}, []string{"fcitx5"}, CheckPass},
+		{"disagreeing", map[string]string{"GTK_IM_MODULE": "fcitx", "QT_IM_MODULE": "fcitx", "XMODIFIERS": "@im=ibus"}, []string{"ibus"}, CheckWarn},
+		{"partially set", map[string]string{"GTK_IM_MODULE": "ibus"}, []string{"ibus"}, CheckWarn},
+		{"framework not running", map[string]string{"GTK_IM_MODULE": "ibus", "QT_IM_MODULE": "ibus", "XMODIFIERS": "@im=ibus"}, []string{"fcitx5"}, CheckWarn},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			clearIMEnv(t)
+			for key, value := range tc.env {
+				t.Setenv(key, value)
+			}
+			if check := envCheck(tc.running); check.Status != tc.expected {
+				t.Errorf("envCheck() = %+v, want status %s", check, tc.expected)
+			}
+		})
+	}
+}
+
+func TestDiagnose(t *testing.T) {
+	withBackends(t)
+	clearIMEnv(t)
+	Register(stubBackend{name: "a", current: "us", sources: []string{"us", "kr"}}, 10)
+
+	useFakeRunner(t, []string{"ibus", "fcitx5-remote"},
+		fakeCall{cmd: "pgrep -x ibus-daemon"},
+		fakeCall{cmd: "pgrep -x fcitx5"},
+		fakeCall{cmd: "pgrep -x fcitx", exitCode: 1},
+	)
+
+	checks := New(WithBackend("a")).Diagnose(context.Background(), "jp")
+	got := map[string]CheckStatus{}
+	for _, check := range checks {
+		got[check.Name] = check.Status
+		if check.Status != CheckPass && check.Advice == "" {
+			t.Errorf("Check %s has no advice: %+v", check.Name, check)
+		}
+	}
+	expected := map[string]CheckStatus{
+		"frameworks":  CheckPass,
+		"daemons":     CheckWarn,
+		"environment": CheckWarn,
+		"backend":     CheckPass,
+		"current":     CheckPass,
+		"list":        CheckPass,
+		"default":     CheckWarn,
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Diagnose() statuses = %v, want %v", got, expected)
+	}
+}
+
+func TestPlatformChecksFcitx5Alone(t *testing.T) {
+	clearIMEnv(t)
+
+	// pgrep -x fcitx does not match the fcitx5 daemon, so only one
+	// framework is running.
+	useFakeRunner(t, []string{"fcitx5-remote"},
+		fakeCall{cmd: "pgrep -x ibus-daemon", exitCode: 1},
+		fakeCall{cmd: "pgrep -x fcitx5"},
+		fakeCall{cmd: "pgrep -x fcitx", exitCode: 1},
+	)
+
+	for _, check := range platformChecks(context.Background(), "fcitx5") {
+		if check.Name == "daemons" && check.Status != CheckPass {
+			t.Errorf("daemons check = %+v, want a pass with only fcitx5 running", check)
+		}
+	}
+}
+
+func TestDiagnoseXKBOnWayland(t *testing.T) {
+	withBackends(t)
+	clearIMEnv(t)
+	t.Setenv("XDG_SESSION_TYPE", "wayland")
+	Register(stubBackend{name: "xkb", current: "us", sources: []string{"us"}}, 10)
+
+	useFakeRunner(t, []string{"setxkbmap"},
+		fakeCall{cmd: "pgrep -x ibus-daemon", exitCode: 1},
+		fakeCall{cmd: "pgrep -x fcitx5", exitCode: 1},
+		fakeCall{cmd: "pgrep -x fcitx", exitCode: 1},
+	)
+
+	for _, check := range New(WithBackend("xkb")).Diagnose(context.Background(), "") {
+		if check.Name == "session" {
+			if check.Status != CheckWarn {
+				t.Errorf("session check = %+v, want a warning", check)
+			}
+			return
+		}
+	}
+	t.Error("Diagnose() should check the session type for the xkb backend")
+}
+
+func TestDiagnoseNoBackend(t *testing.T) {
+	withBackends(t)
+	clearIMEnv(t)
+
+	useFakeRunner(t, nil,
+		fakeCall{cmd: "pgrep -x ibus-daemon", exitCode: 1},
+		fakeCall{cmd: "pgrep -x fcitx5", exitCode: 1},
+		fakeCall{cmd: "pgrep -x fcitx", exitCode: 1},
+		// Detection and the framework check each look for the daemons.
+		fakeCall{cmd: "pgrep -x ibus-daemon", exitCode: 1},
+		fakeCall{cmd: "pgrep -x fcitx5", exitCode: 1},
+		fakeCall{cmd: "pgrep -x fcitx", exitCode: 1},
+	)
+
+	checks := New().Diagnose(context.Background(), "")
+	last := checks[len(checks)-1]
+	if last.Name != "backend" || last.Status != CheckFail {
+		t.Errorf("Diagnose() without a backend should end with a failed backend check, got %+v", last)
+	}
+}
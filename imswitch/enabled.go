@@ -0,0 +1,29 @@
+package imswitch
+
+import "context"
+
+// EnabledLister is implemented by backends that can tell which input sources
+// the user has enabled, as opposed to everything List offers. The XKB
+// backend, for one, lists common layouts whether or not they are configured.
+type EnabledLister interface {
+	// Enabled returns the IDs of the enabled sources in the order the
+	// framework switches through them.
+	Enabled(ctx context.Context) ([]string, error)
+}
+
+// Enabled returns the IDs of the input sources the user has enabled. It
+// returns no IDs and no error when the backend cannot tell.
+func (s *Switcher) Enabled(ctx context.Context) ([]string, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	backend, err := s.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	lister, ok := backend.(EnabledLister)
+	if !ok {
+		return nil, nil
+	}
+	return lister.Enabled(ctx)
+}
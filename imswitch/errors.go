@@ -0,0 +1,116 @@
+package imswitch
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Sentinel error kinds. Every error returned by a backend wraps one of these,
+// so callers can test for them with errors.Is.
+var (
+	ErrBackendUnavailable = errors.New("backend unavailable")
+	ErrUnknownSource      = errors.New("unknown input source")
+	ErrAmbiguousSource    = errors.New("ambiguous input source")
+	ErrCommandFailed      = errors.New("backend command failed")
+	ErrTimeout            = errors.New("timed out")
+	ErrPermissionDenied   = errors.New("permission denied")
+	ErrMismatch           = errors.New("input source did not change")
+)
+
+// Error describes a failed backend operation.
+type Error struct {
+	// Kind is one of the Err* sentinels.
+	Kind error
+	// Backend is the name of the backend involved, if any.
+	Backend string
+	// Source is the input source ID involved, if any.
+	Source string
+	// Detail carries extra context such as the stderr of a failed command.
+	Detail string
+	// Candidates lists the matching source IDs of an ambiguous source, or
+	// suggestions for an unknown one.
+	Candidates []string
+	// Err is the underlying error, if any.
+	Err error
+}
+
+func (e *Error) Error() string {
+	var b strings.Builder
+	if e.Backend != "" {
+		b.WriteString(e.Backend)
+		b.WriteString(": ")
+	}
+	b.WriteString(e.Kind.Error())
+	if e.Source != "" {
+		b.WriteString(" '")
+		b.WriteString(e.Source)
+		b.WriteString("'")
+	}
+	if e.Detail != "" {
+		b.WriteString(": ")
+		b.WriteString(e.Detail)
+	} else if e.Err != nil {
+		b.WriteString(": ")
+		b.WriteString(e.Err.Error())
+	}
+	return b.String()
+}
+
+func (e *Error) Unwrap() []error {
+	if e.Err == nil {
+		return []error{e.Kind}
+	}
+	return []error{e.Kind, e.Err}
+}
+
+// ErrorCode returns a stable, machine-readable name for err's kind, such as
+// "unknown_source". It returns "error" for errors of no known kind.
+func ErrorCode(err error) string {
+	switch {
+	case errors.Is(err, ErrBackendUnavailable):
+		return "backend_unavailable"
+	case errors.Is(err, ErrUnknownSource):
+		return "unknown_source"
+	case errors.Is(err, ErrAmbiguousSource):
+		return "ambiguous_source"
+	case errors.Is(err, ErrCommandFailed):
+		return "command_failed"
+	case errors.Is(err, ErrTimeout):
+		return "timeout"
+	case errors.Is(err, ErrPermissionDenied):
+		return "permission_denied"
+	case errors.Is(err, ErrMismatch):
+		return "mismatch"
+	default:
+		return "error"
+	}
+}
+
+// commandFailure converts an error from the command runner into an *Error
+// for the given backend and source.
+func commandFailure(backend, source string, err error) error {
+	var cmdErr *commandError
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return &Error{Kind: ErrTimeout, Backend: backend, Source: source, Err: err}
+	case errors.As(err, &cmdErr):
+		return &Error{Kind: ErrCommandFailed, Backend: backend, Source: source, Detail: cmdErr.Stderr, Err: err}
+	case errors.Is(err, os.ErrPermission):
+		return &Error{Kind: ErrPermissionDenied, Backend: backend, Source: source, Err: err}
+	case errors.Is(err, exec.ErrNotFound):
+		return &Error{Kind: ErrBackendUnavailable, Backend: backend, Err: err}
+	default:
+		return &Error{Kind: ErrCommandFailed, Backend: backend, Source: source, Err: err}
+	}
+}
+
+// unknownSource returns an ErrUnknownSource error unless sourceID is listed.
+func unknownSource(backend, sourceID string, sources []InputSource) error {
+	if _, ok := findSource(sources, sourceID); ok {
+		return nil
+	}
+	return unknownSourceError(backend, sources, sourceID)
+}
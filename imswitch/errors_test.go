@@ -0,0 +1,71 @@
+package imswitch
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"testing"
+)
+
+func TestErrorCode(t *testing.T) {
+	testCases := []struct {
+		err  error
+		code string
+	}{
+		{errors.New("boom"), "error"},
+		{&Error{Kind: ErrBackendUnavailable}, "backend_unavailable"},
+		{&Error{Kind: ErrUnknownSource, Source: "x"}, "unknown_source"},
+		{&Error{Kind: ErrAmbiguousSource, Source: "x"}, "ambiguous_source"},
+		{&Error{Kind: ErrCommandFailed}, "command_failed"},
+		{&Error{Kind: ErrTimeout}, "timeout"},
+		{&Error{Kind: ErrPermissionDenied}, "permission_denied"},
+		{&Error{Kind: ErrMismatch, Source: "x"}, "mismatch"},
+		{fmt.Errorf("wrapped: %w", &Error{Kind: ErrUnknownSource}), "unknown_source"},
+	}
+
+	for _, tc := range testCases {
+		if got := ErrorCode(tc.err); got != tc.code {
+			t.Errorf("ErrorCode(%v) = %q, want %q", tc.err, got, tc.code)
+		}
+	}
+}
+
+func TestErrorMessage(t *testing.T) {
+	testCases := []struct {
+		err      *Error
+		expected string
+	}{
+		{&Error{Kind: ErrUnknownSource, Backend: "ibus", Source: "hangl"}, "ibus: unknown input source 'hangl'"},
+		{&Error{Kind: ErrCommandFailed, Backend: "ibus", Detail: "Can't connect to IBus."}, "ibus: backend command failed: Can't connect to IBus."},
+		{&Error{Kind: ErrBackendUnavailable, Detail: "no input method framework detected"}, "backend unavailable: no input method framework detected"},
+	}
+
+	for _, tc := range testCases {
+		if got := tc.err.Error(); got != tc.expected {
+			t.Errorf("Error() = %q, want %q", got, tc.expected)
+		}
+	}
+}
+
+func TestCommandFailure(t *testing.T) {
+	testCases := []struct {
+		err  error
+		kind error
+	}{
+		{&commandError{Name: "ibus", ExitCode: 1, Stderr: "oops"}, ErrCommandFailed},
+		{&os.PathError{Op: "fork/exec", Path: "/usr/bin/ibus", Err: os.ErrPermission}, ErrPermissionDenied},
+		{&exec.Error{Name: "ibus", Err: exec.ErrNotFound}, ErrBackendUnavailable},
+		{errors.New("unexpected"), ErrCommandFailed},
+	}
+
+	for _, tc := range testCases {
+		err := commandFailure("ibus", "hangul", tc.err)
+		if !errors.Is(err, tc.kind) {
+			t.Errorf("commandFailure(%v) = %v, want kind %v", tc.err, err, tc.kind)
+		}
+		if !errors.Is(err, tc.err) {
+			t.Errorf("commandFailure(%v) should wrap the original error", tc.err)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+//go:build darwin
+
+package imswitch
+
+/*
+#cgo CFLAGS: -x objective-c
+#cgo LDFLAGS: -framework Foundation -framework Carbon
+
+#include <Carbon/Carbon.h>
+#include <CoreFoundation/CoreFoundation.h>
+
+// Get current input source
+CFStringRef getCurrentInputSource() {
+    TISInputSourceRef currentSource = TISCopyCurrentKeyboardInputSource();
+    if (currentSource == NULL) {
+        return NULL;
+    }
+
+    CFStringRef sourceID = (CFStringRef)TISGetInputSourceProperty(currentSource, kTISPropertyInputSourceID);
+    CFRetain(sourceID);
+    CFRelease(currentSource);
+
+    return sourceID;
+}
+
+// Get all input sources
+CFArrayRef getAllInputSources() {
+    CFStringRef keys[] = {kTISPropertyInputSourceCategory};
+    CFStringRef values[] = {kTISCategoryKeyboardInputSource};
+    CFDictionaryRef filter = CFDictionaryCreate(
+        kCFAllocatorDefault,
+        (const void**)keys,
+        (const void**)values,
+        1,
+        &kCFTypeDictionaryKeyCallBacks,
+        &kCFTypeDictionaryValueCallBacks
+    );
+
+    CFArrayRef inputSources = TISCreateInputSourceList(filter, false);
+    CFRelease(filter);
+
+    return inputSources;
+}
+
+// Set input source by ID. Returns 0 on success, 1 if no input source has
+// the ID and 2 if selecting it failed.
+int setInputSource(CFStringRef sourceID) {
+    CFStringRef keys[] = {kTISPropertyInputSourceID};
+    CFStringRef values[] = {sourceID};
+    CFDictionaryRef filter = CFDictionaryCreate(
+        kCFAllocatorDefault,
+        (const void**)keys,
+        (const void**)values,
+        1,
+        &kCFTypeDictionaryKeyCallBacks,
+        &kCFTypeDictionaryValueCallBacks
+    );
+
+    CFArrayRef inputSources = TISCreateInputSourceList(filter, false);
+    CFRelease(filter);
+
+    if (inputSources == NULL || CFArrayGetCount(inputSources) == 0) {
+        if (inputSources) CFRelease(inputSources);
+        return 1;
+    }
+
+    TISInputSourceRef source = (TISInputSourceRef)CFArrayGetValueAtIndex(inputSources, 0);
+    OSStatus status = TISSelectInputSource(source);
+    CFRelease(inputSources);
+
+    return status == noErr ? 0 : 2;
+}
+
+// Get the primary language of an input source, or NULL
+CFStringRef getSourceLanguage(TISInputSourceRef source) {
+    CFArrayRef languages = (CFArrayRef)TISGetInputSourceProperty(source, kTISPropertyInputSourceLanguages);
+    if (languages == NULL || CFArrayGetCount(languages) == 0) {
+        return NULL;
+    }
+    return (CFStringRef)CFArrayGetValueAtIndex(languages, 0);
+}
+
+// Check whether an input source is a plain keyboard layout
+bool isKeyboardLayout(TISInputSourceRef source) {
+    CFStringRef type = (CFStringRef)TISGetInputSourceProperty(source, kTISPropertyInputSourceType);
+    return type != NULL && CFEqual(type, kTISTypeKeyboardLayout);
+}
+
+// Convert CFString to C string
+char* cfStringToCString(CFStringRef cfStr) {
+    if (cfStr == NULL) return NULL;
+
+    CFIndex length = CFStringGetLength(cfStr);
+    CFIndex maxSize = CFStringGetMaximumSizeForEncoding(length, kCFStringEncodingUTF8) + 1;
+    char* buffer = malloc(maxSize);
+    if (buffer == NULL) return NULL;
+
+    if (CFStringGetCString(cfStr, buffer, maxSize, kCFStringEncodingUTF8)) {
+        return buffer;
+    }
+
+    free(buffer);
+    return NULL;
+}
+*/
+import "C"
+import (
+	"context"
+	"runtime"
+	"unsafe"
+)
+
+func init() {
+	Register(tisBackend{}, 10)
+}
+
+// detectInputMethod always selects the Text Input Source backend on macOS
+func detectInputMethod(ctx context.Context) (string, error) {
+	return "macos", nil
+}
+
+// explain reports the only backend supported on this platform.
+func explain(ctx context.Context) (DetectionReport, error) {
+	var report DetectionReport
+	report.beginProbe("platform")
+	report.observe("GOOS=%s", runtime.GOOS)
+	report.finish("macos")
+	return report, nil
+}
+
+// platformChecks has nothing to inspect beyond the backend itself here.
+func platformChecks(ctx context.Context, backend string) []Check {
+	return nil
+}
+
+// tisBackend switches input sources through the macOS Text Input Source APIs.
+type tisBackend struct{}
+
+func (tisBackend) Name() string { return "macos" }
+
+func (tisBackend) Available() bool { return true }
+
+func (b tisBackend) Current(ctx context.Context) (string, error) {
+	cfStr := C.getCurrentInputSource()
+	if cfStr == C.CFStringRef(unsafe.Pointer(nil)) {
+		return "", &Error{Kind: ErrCommandFailed, Backend: b.Name(), Detail: "no current keyboard input source"}
+	}
+	defer C.CFRelease(C.CFTypeRef(cfStr))
+
+	cStr := C.cfStringToCString(cfStr)
+	if cStr == (*C.char)(unsafe.Pointer(nil)) {
+		return "", &Error{Kind: ErrCommandFailed, Backend: b.Name(), Detail: "could not convert input source ID"}
+	}
+	defer C.free(unsafe.Pointer(cStr))
+
+	return C.GoString(cStr), nil
+}
+
+// goString copies a CFString that the caller does not own.
+func goString(cfStr C.CFStringRef) string {
+	if cfStr == C.CFStringRef(unsafe.Pointer(nil)) {
+		return ""
+	}
+
+	cStr := C.cfStringToCString(cfStr)
+	if cStr == (*C.char)(unsafe.Pointer(nil)) {
+		return ""
+	}
+	defer C.free(unsafe.Pointer(cStr))
+
+	return C.GoString(cStr)
+}
+
+func (b tisBackend) List(ctx context.Context) ([]InputSource, error) {
+	sources := C.getAllInputSources()
+	if sources == C.CFArrayRef(unsafe.Pointer(nil)) {
+		return nil, &Error{Kind: ErrCommandFailed, Backend: b.Name(), Detail: "could not list input sources"}
+	}
+	defer C.CFRelease(C.CFTypeRef(sources))
+
+	count := C.CFArrayGetCount(sources)
+	result := make([]InputSource, 0, count)
+
+	for i := C.CFIndex(0); i < count; i++ {
+		source := C.TISInputSourceRef(C.CFArrayGetValueAtIndex(sources, i))
+		if source == C.TISInputSourceRef(unsafe.Pointer(nil)) {
+			continue
+		}
+
+		id := goString(C.CFStringRef(C.TISGetInputSourceProperty(source, C.kTISPropertyInputSourceID)))
+		if id == "" {
+			continue
+		}
+
+		kind := KindInputMethod
+		if C.isKeyboardLayout(source) {
+			kind = KindLayout
+		}
+		result = append(result, InputSource{
+			ID:       id,
+			Name:     goString(C.CFStringRef(C.TISGetInputSourceProperty(source, C.kTISPropertyLocalizedName))),
+			Language: goString(C.getSourceLanguage(source)),
+			Backend:  b.Name(),
+			Kind:     kind,
+		})
+	}
+
+	return result, nil
+}
+
+// Enabled returns the listed sources, since List leaves out the ones that
+// are installed but not enabled in System Settings.
+func (b tisBackend) Enabled(ctx context.Context) ([]string, error) {
+	sources, err := b.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return sourceIDs(sources), nil
+}
+
+func (b tisBackend) Set(ctx context.Context, sourceID string) error {
+	cStr := C.CString(sourceID)
+	defer C.free(unsafe.Pointer(cStr))
+
+	cfStr := C.CFStringCreateWithCString(C.kCFAllocatorDefault, cStr, C.kCFStringEncodingUTF8)
+	defer C.CFRelease(C.CFTypeRef(cfStr))
+
+	switch C.setInputSource(cfStr) {
+	case 0:
+		return nil
+	case 1:
+		return &Error{Kind: ErrUnknownSource, Backend: b.Name(), Source: sourceID}
+	default:
+		return &Error{Kind: ErrCommandFailed, Backend: b.Name(), Source: sourceID, Detail: "TISSelectInputSource failed"}
+	}
+}
\ No newline at end of file
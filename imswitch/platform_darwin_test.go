@@ -1,31 +1,33 @@
 //go:build darwin
 
-package main
+package imswitch
 
 import (
+	"context"
+	"errors"
 	"testing"
 )
 
 func TestDarwinInputSourceFunctions(t *testing.T) {
-	current := getCurrentInputSource()
-	if current == "" {
-		t.Error("getCurrentInputSource() returned empty string on macOS")
+	current, err := New().Current(context.Background())
+	if err != nil {
+		t.Errorf("Current() returned error on macOS: %v", err)
 	}
 
-	sources := getAllInputSources()
-	if sources == nil {
-		t.Error("getAllInputSources() returned nil on macOS")
+	sources, err := New().List(context.Background())
+	if err != nil {
+		t.Errorf("List() returned error on macOS: %v", err)
 		return
 	}
 
 	if len(sources) == 0 {
-		t.Error("getAllInputSources() returned empty slice on macOS")
+		t.Error("List() returned empty slice on macOS")
 		return
 	}
 
 	found := false
 	for _, source := range sources {
-		if source == current {
+		if source.ID == current {
 			found = true
 			break
 		}
@@ -37,31 +39,29 @@ func TestDarwinInputSourceFunctions(t *testing.T) {
 }
 
 func TestDarwinSetInputSource(t *testing.T) {
-	originalSource := getCurrentInputSource()
-	if originalSource == "" {
+	originalSource, err := New().Current(context.Background())
+	if err != nil {
 		t.Skip("Cannot get current input source")
 	}
 
-	result := setInputSource(originalSource)
-	if !result {
-		t.Error("setInputSource() failed to set current input source")
+	if err := New().Set(context.Background(), originalSource); err != nil {
+		t.Errorf("Set() failed to set current input source: %v", err)
 	}
 
-	result = setInputSource("invalid-source-id")
-	if result {
-		t.Error("setInputSource() should fail for invalid source ID")
+	if err := New().Set(context.Background(), "invalid-source-id"); !errors.Is(err, ErrUnknownSource) {
+		t.Errorf("Set() should fail with ErrUnknownSource for invalid source ID, got %v", err)
 	}
 }
 
 func TestDarwinCommonInputSources(t *testing.T) {
-	sources := getAllInputSources()
+	sources, _ := New().List(context.Background())
 	if len(sources) == 0 {
 		t.Skip("No input sources available")
 	}
 
 	hasABC := false
 	for _, source := range sources {
-		if source == "com.apple.keylayout.ABC" {
+		if source.ID == "com.apple.keylayout.ABC" {
 			hasABC = true
 			break
 		}
@@ -73,20 +73,20 @@ func TestDarwinCommonInputSources(t *testing.T) {
 }
 
 func TestDarwinInputSourceSwitching(t *testing.T) {
-	sources := getAllInputSources()
+	sources, _ := New().List(context.Background())
 	if len(sources) < 2 {
 		t.Skip("Need at least 2 input sources for switching test")
 	}
 
-	originalSource := getCurrentInputSource()
-	if originalSource == "" {
+	originalSource, err := New().Current(context.Background())
+	if err != nil {
 		t.Skip("Cannot get current input source")
 	}
 
 	var targetSource string
 	for _, source := range sources {
-		if source != originalSource {
-			targetSource = source
+		if source.ID != originalSource {
+			targetSource = source.ID
 			break
 		}
 	}
@@ -95,15 +95,15 @@ func TestDarwinInputSourceSwitching(t *testing.T) {
 		t.Skip("Could not find alternative input source")
 	}
 
-	if !setInputSource(targetSource) {
+	if err := New().Set(context.Background(), targetSource); err != nil {
 		t.Skip("Could not switch to target source (may not be enabled)")
 	}
 
-	currentAfterSwitch := getCurrentInputSource()
+	currentAfterSwitch, _ := New().Current(context.Background())
 	if currentAfterSwitch != targetSource {
 		t.Log("Input source may not have switched immediately (this can be normal)")
 	}
 
-	setInputSource(originalSource)
+	New().Set(context.Background(), originalSource)
 }
 
@@ -0,0 +1,369 @@
+//go:build linux
+
+package imswitch
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// Linux input method switching using multiple backends
+// Supports: ibus, fcitx, fcitx5, xkb
+
+func init() {
+	Register(ibusBackend{}, 10)
+	Register(fcitxBackend{name: "fcitx5", remote: "fcitx5-remote"}, 20)
+	Register(fcitxBackend{name: "fcitx", remote: "fcitx-remote"}, 30)
+	Register(xkbBackend{}, 100)
+}
+
+// isProcessRunning reports whether a process named exactly process is
+// running. A plain pgrep pattern would also match "fcitx" against fcitx5.
+// When ctx is done before pgrep answers, ctx.Err() is returned rather than
+// reporting the process as stopped.
+func isProcessRunning(ctx context.Context, process string) (bool, error) {
+	_, err := runner.Run(ctx, "pgrep", "-x", process)
+	if err != nil && ctx.Err() != nil {
+		return false, ctx.Err()
+	}
+	return err == nil, nil
+}
+
+func hasCommand(name string) bool {
+	return runner.LookPath(name)
+}
+
+// commandOutput runs a backend command and returns its trimmed stdout.
+func commandOutput(ctx context.Context, backend, name string, args ...string) (string, error) {
+	output, err := runner.Run(ctx, name, args...)
+	if err != nil {
+		return "", commandFailure(backend, "", err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// runSet runs a backend command that switches to sourceID.
+func runSet(ctx context.Context, backend, sourceID, name string, args ...string) error {
+	if _, err := runner.Run(ctx, name, args...); err != nil {
+		return commandFailure(backend, sourceID, err)
+	}
+	return nil
+}
+
+// requireCurrent turns an empty current source into an error.
+func requireCurrent(backend, current string) (string, error) {
+	if current == "" {
+		return "", &Error{Kind: ErrCommandFailed, Backend: backend, Detail: "no current input source reported"}
+	}
+	return current, nil
+}
+
+// nonEmptyLines splits output into trimmed, non-empty lines.
+func nonEmptyLines(output string) []string {
+	var lines []string
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// ibusBackend switches engines through the ibus CLI.
+type ibusBackend struct{}
+
+func (ibusBackend) Name() string { return "ibus" }
+
+func (ibusBackend) Available() bool {
+	return hasCommand("ibus")
+}
+
+func (b ibusBackend) Current(ctx context.Context) (string, error) {
+	output, err := commandOutput(ctx, b.Name(), "ibus", "engine")
+	if err != nil {
+		return "", err
+	}
+	return requireCurrent(b.Name(), output)
+}
+
+func (b ibusBackend) List(ctx context.Context) ([]InputSource, error) {
+	output, err := commandOutput(ctx, b.Name(), "ibus", "list-engine")
+	if err != nil {
+		return nil, err
+	}
+	return parseIBusEngines(output), nil
+}
+
+// parseIBusEngines parses `ibus list-engine`, which lists engines as
+// "  <name> - <description>" under "language: <language>" headings.
+func parseIBusEngines(output string) []InputSource {
+	var sources []InputSource
+	language := ""
+	for _, line := range nonEmptyLines(output) {
+		if heading, ok := strings.CutPrefix(line, "language:"); ok {
+			language = strings.TrimSpace(heading)
+			continue
+		}
+
+		id, description, _ := strings.Cut(line, " - ")
+		id = strings.TrimSpace(id)
+
+		var source InputSource
+		if rest, ok := strings.CutPrefix(id, "xkb:"); ok {
+			// xkb:<layout>:<variant>:<language>
+			parts := strings.Split(rest, ":")
+			variant := ""
+			if len(parts) > 1 {
+				variant = parts[1]
+			}
+			source = layoutSource("ibus", id, parts[0], variant)
+		} else {
+			source = engineSource("ibus", id)
+		}
+		if description = strings.TrimSpace(description); description != "" {
+			source.Name = description
+		}
+		if code := languageCode(language); code != "" {
+			source.Language = code
+		}
+		sources = append(sources, source)
+	}
+	return sources
+}
+
+// Enabled reads the engines the user added in the IBus preferences, which
+// are stored in the preload-engines setting.
+func (b ibusBackend) Enabled(ctx context.Context) ([]string, error) {
+	output, err := commandOutput(ctx, b.Name(), "gsettings", "get", "org.freedesktop.ibus.general", "preload-engines")
+	if err != nil {
+		return nil, err
+	}
+	return parseStringArray(output), nil
+}
+
+// parseStringArray parses a GVariant string array as printed by gsettings,
+// such as "['xkb:us::eng', 'hangul']" or "@as []" when it is empty.
+func parseStringArray(output string) []string {
+	output = strings.TrimPrefix(strings.TrimSpace(output), "@as ")
+	output = strings.TrimSuffix(strings.TrimPrefix(output, "["), "]")
+
+	var values []string
+	for _, value := range strings.Split(output, ",") {
+		if value = strings.Trim(strings.TrimSpace(value), `'"`); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// Set only lists the engines when ibus engine fails, to tell an unknown
+// engine, reported with the nearest IDs, from a daemon that is not responding.
+func (b ibusBackend) Set(ctx context.Context, sourceID string) error {
+	err := runSet(ctx, b.Name(), sourceID, "ibus", "engine", sourceID)
+	if !errors.Is(err, ErrCommandFailed) {
+		return err
+	}
+	sources, listErr := b.List(ctx)
+	if listErr != nil {
+		return err
+	}
+	if unknown := unknownSource(b.Name(), sourceID, sources); unknown != nil {
+		return unknown
+	}
+	return err
+}
+
+// Events follows the GlobalEngineChanged signal on the IBus daemon's own bus.
+func (b ibusBackend) Events(ctx context.Context) (<-chan struct{}, error) {
+	addrCtx, cancel := context.WithTimeout(ctx, DefaultTimeout)
+	defer cancel()
+	address, err := commandOutput(addrCtx, b.Name(), "ibus", "address")
+	if err != nil {
+		return nil, err
+	}
+	return dbusSignals(ctx, b.Name(), "GlobalEngineChanged",
+		"--address", address, "type='signal',interface='org.freedesktop.IBus',member='GlobalEngineChanged'")
+}
+
+// fcitxBackend switches input methods through fcitx-remote or fcitx5-remote,
+// which share the same command line interface.
+type fcitxBackend struct {
+	name   string
+	remote string
+}
+
+func (b fcitxBackend) Name() string { return b.name }
+
+func (b fcitxBackend) Available() bool {
+	return hasCommand(b.remote)
+}
+
+func (b fcitxBackend) Current(ctx context.Context) (string, error) {
+	output, err := commandOutput(ctx, b.name, b.remote, "-n")
+	if err != nil {
+		return "", err
+	}
+	return requireCurrent(b.name, output)
+}
+
+func (b fcitxBackend) List(ctx context.Context) ([]InputSource, error) {
+	output, err := commandOutput(ctx, b.name, b.remote, "-l")
+	if err != nil {
+		return nil, err
+	}
+
+	var sources []InputSource
+	for _, id := range nonEmptyLines(output) {
+		sources = append(sources, fcitxSource(b.name, id))
+	}
+	return sources, nil
+}
+
+// fcitxSource describes a fcitx input method. Keyboard layouts are named
+// "keyboard-<layout>[-<variant>]", with an extra "fcitx-" prefix on fcitx 4.
+func fcitxSource(backend, id string) InputSource {
+	name := strings.TrimPrefix(id, "fcitx-")
+	if layout, ok := strings.CutPrefix(name, "keyboard-"); ok {
+		layout, variant, _ := strings.Cut(layout, "-")
+		return layoutSource(backend, id, layout, variant)
+	}
+	return engineSource(backend, id)
+}
+
+// Set validates sourceID first because fcitx5-remote -s exits successfully
+// even for input methods that do not exist.
+func (b fcitxBackend) Set(ctx context.Context, sourceID string) error {
+	sources, err := b.List(ctx)
+	if err != nil {
+		return err
+	}
+	if err := unknownSource(b.name, sourceID, sources); err != nil {
+		return err
+	}
+	return runSet(ctx, b.name, sourceID, b.remote, "-s", sourceID)
+}
+
+// Events follows the CurrentIM signal that Fcitx5 sends to input contexts on
+// the session bus. Fcitx 4 has no equivalent and is polled.
+func (b fcitxBackend) Events(ctx context.Context) (<-chan struct{}, error) {
+	if b.name != "fcitx5" {
+		return nil, &Error{Kind: ErrBackendUnavailable, Backend: b.name, Detail: "change events not supported"}
+	}
+	return dbusSignals(ctx, b.name, "CurrentIM",
+		"--session", "type='signal',interface='org.fcitx.Fcitx.InputContext1',member='CurrentIM'")
+}
+
+// dbusSignals runs dbus-monitor with args and sends on the returned channel
+// for every signal named member. Bursts of signals are coalesced.
+func dbusSignals(ctx context.Context, backend, member string, args ...string) (<-chan struct{}, error) {
+	if !hasCommand("dbus-monitor") {
+		return nil, &Error{Kind: ErrBackendUnavailable, Backend: backend, Detail: "dbus-monitor not found"}
+	}
+	lines, err := runner.Stream(ctx, "dbus-monitor", args...)
+	if err != nil {
+		return nil, commandFailure(backend, "", err)
+	}
+
+	events := make(chan struct{}, 1)
+	go func() {
+		defer close(events)
+		for line := range lines {
+			if strings.HasPrefix(line, "signal ") && strings.Contains(line, "member="+member) {
+				select {
+				case events <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+	return events, nil
+}
+
+// xkbBackend switches X keyboard layouts through setxkbmap.
+type xkbBackend struct{}
+
+func (xkbBackend) Name() string { return "xkb" }
+
+func (xkbBackend) Available() bool {
+	return hasCommand("setxkbmap")
+}
+
+func (b xkbBackend) unavailable() error {
+	return &Error{Kind: ErrBackendUnavailable, Backend: b.Name(), Detail: "setxkbmap not found"}
+}
+
+func (b xkbBackend) Current(ctx context.Context) (string, error) {
+	if !b.Available() {
+		return "", b.unavailable()
+	}
+
+	output, err := commandOutput(ctx, b.Name(), "setxkbmap", "-query")
+	if err != nil {
+		return "", err
+	}
+
+	for _, line := range strings.Split(output, "\n") {
+		if strings.HasPrefix(line, "layout:") {
+			parts := strings.Fields(line)
+			if len(parts) >= 2 {
+				return parts[1], nil
+			}
+		}
+	}
+	return requireCurrent(b.Name(), "")
+}
+
+func (b xkbBackend) List(ctx context.Context) ([]InputSource, error) {
+	if !b.Available() {
+		return nil, b.unavailable()
+	}
+
+	// Common keyboard layouts
+	layouts := []string{
+		"us",
+		"gb",
+		"de",
+		"fr",
+		"es",
+		"it",
+		"ru",
+		"cn",
+		"jp",
+		"kr",
+	}
+
+	sources := make([]InputSource, 0, len(layouts))
+	for _, layout := range layouts {
+		sources = append(sources, layoutSource(b.Name(), layout, layout, ""))
+	}
+	return sources, nil
+}
+
+// xkbBackend does not implement EnabledLister. The layouts in setxkbmap
+// -query are XKB groups, and switching to one with setxkbmap would replace the
+// whole layout list.
+
+// PartialList reports that List only holds common layouts.
+func (xkbBackend) PartialList() bool {
+	return true
+}
+
+// xkbUnknownLayout is what setxkbmap prints when it has no layout, variant
+// or option of the given name.
+const xkbUnknownLayout = "Error loading new keyboard description"
+
+// Set does not validate against List, which only holds common layouts;
+// setxkbmap itself rejects layouts that do not exist.
+func (b xkbBackend) Set(ctx context.Context, sourceID string) error {
+	if !b.Available() {
+		return b.unavailable()
+	}
+	err := runSet(ctx, b.Name(), sourceID, "setxkbmap", sourceID)
+	var e *Error
+	if errors.As(err, &e) && e.Kind == ErrCommandFailed && strings.Contains(e.Detail, xkbUnknownLayout) {
+		return &Error{Kind: ErrUnknownSource, Backend: b.Name(), Source: sourceID, Err: e.Err}
+	}
+	return err
+}
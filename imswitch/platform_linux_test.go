@@ -0,0 +1,553 @@
+//go:build linux
+
+package imswitch
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const ibusEngines = "language: English\n  xkb:us::eng - English (US)\nlanguage: Korean\n  hangul - Korean\n"
+
+// clearIMEnv removes every variable the detection chain looks at.
+func clearIMEnv(t *testing.T) {
+	for _, key := range append(imEnvVars, "XDG_SESSION_TYPE", "WAYLAND_DISPLAY", "DISPLAY", BackendEnvVar) {
+		t.Setenv(key, "")
+	}
+}
+
+func TestDetectInputMethod(t *testing.T) {
+	testCases := []struct {
+		name     string
+		env      map[string]string
+		paths    []string
+		calls    []fakeCall
+		expected string
+	}{
+		{
+			name:     "ibus from GTK_IM_MODULE",
+			env:      map[string]string{"GTK_IM_MODULE": "ibus"},
+			paths:    []string{"ibus"},
+			expected: "ibus",
+		},
+		{
+			name:  "fcitx module name with fcitx5 running",
+			env:   map[string]string{"GTK_IM_MODULE": "fcitx"},
+			paths: []string{"fcitx5-remote", "fcitx-remote"},
+			calls: []fakeCall{
+				{cmd: "pgrep -x fcitx5"},
+				{cmd: "pgrep -x fcitx", exitCode: 1},
+			},
+			expected: "fcitx5",
+		},
+		{
+			name:  "XMODIFIERS with legacy fcitx running",
+			env:   map[string]string{"XMODIFIERS": "@im=fcitx"},
+			paths: []string{"fcitx5-remote", "fcitx-remote"},
+			calls: []fakeCall{
+				{cmd: "pgrep -x fcitx5", exitCode: 1},
+				{cmd: "pgrep -x fcitx"},
+			},
+			expected: "fcitx",
+		},
+		{
+			name:  "env points at missing ibus, daemon fallback",
+			env:   map[string]string{"QT_IM_MODULE": "ibus"},
+			paths: []string{"fcitx5-remote"},
+			calls: []fakeCall{
+				{cmd: "pgrep -x ibus-daemon", exitCode: 1},
+				{cmd: "pgrep -x fcitx5"},
+			},
+			expected: "fcitx5",
+		},
+		{
+			name:  "plain X11 session falls back to xkb",
+			env:   map[string]string{"DISPLAY": ":0"},
+			paths: []string{"setxkbmap"},
+			calls: []fakeCall{
+				{cmd: "pgrep -x ibus-daemon", exitCode: 1},
+				{cmd: "pgrep -x fcitx5", exitCode: 1},
+				{cmd: "pgrep -x fcitx", exitCode: 1},
+			},
+			expected: "xkb",
+		},
+		{
+			name:  "wayland session uses installed tools",
+			env:   map[string]string{"XDG_SESSION_TYPE": "wayland"},
+			paths: []string{"fcitx5-remote", "setxkbmap"},
+			calls: []fakeCall{
+				{cmd: "pgrep -x ibus-daemon", exitCode: 1},
+				{cmd: "pgrep -x fcitx5", exitCode: 1},
+				{cmd: "pgrep -x fcitx", exitCode: 1},
+			},
+			expected: "fcitx5",
+		},
+		{
+			name: "nothing installed",
+			calls: []fakeCall{
+				{cmd: "pgrep -x ibus-daemon", exitCode: 1},
+				{cmd: "pgrep -x fcitx5", exitCode: 1},
+				{cmd: "pgrep -x fcitx", exitCode: 1},
+			},
+			expected: "",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			clearIMEnv(t)
+			for key, value := range tc.env {
+				t.Setenv(key, value)
+			}
+			useFakeRunner(t, tc.paths, tc.calls...)
+
+			method, err := detectInputMethod(context.Background())
+			if err != nil {
+				t.Fatalf("detectInputMethod() returned error: %v", err)
+			}
+			if method != tc.expected {
+				t.Errorf("detectInputMethod(context.Background()) = %q, want %q", method, tc.expected)
+			}
+		})
+	}
+}
+
+func TestIsProcessRunning(t *testing.T) {
+	useFakeRunner(t, nil,
+		fakeCall{cmd: "pgrep -x nonexistent-process-12345", exitCode: 1},
+		fakeCall{cmd: "pgrep -x init", stdout: "1\n"},
+	)
+
+	result, err := isProcessRunning(context.Background(), "nonexistent-process-12345")
+	if err != nil || result {
+		t.Errorf("isProcessRunning() = %t, %v, want false for non-existent process", result, err)
+	}
+
+	result, err = isProcessRunning(context.Background(), "init")
+	if err != nil || !result {
+		t.Errorf("isProcessRunning() = %t, %v, want true for init process", result, err)
+	}
+}
+
+func TestIsProcessRunningMatchesExactName(t *testing.T) {
+	// Without -x, "pgrep fcitx" also finds fcitx5 and legacy fcitx looks
+	// like it is running next to it.
+	useFakeRunner(t, nil, fakeCall{cmd: "pgrep -x fcitx", exitCode: 1})
+
+	if running, _ := isProcessRunning(context.Background(), "fcitx"); running {
+		t.Error("isProcessRunning() should return false when only fcitx5 is running")
+	}
+}
+
+func TestDetectionTimeoutIsNotCached(t *testing.T) {
+	clearIMEnv(t)
+	useFakeRunner(t, []string{"fcitx5-remote"},
+		fakeCall{cmd: "pgrep -x ibus-daemon", hang: true},
+		fakeCall{cmd: "pgrep -x ibus-daemon", exitCode: 1},
+		fakeCall{cmd: "pgrep -x fcitx5", exitCode: 1},
+		fakeCall{cmd: "pgrep -x fcitx", exitCode: 1},
+	)
+
+	// The hung probe must not fall through to the tools probe, and the
+	// Switcher must detect again on the next call.
+	switcher := New(WithTimeout(10 * time.Millisecond))
+	if _, err := switcher.Backend(context.Background()); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("Backend() error = %v, want ErrTimeout", err)
+	}
+	backend, err := switcher.Backend(context.Background())
+	if err != nil || backend.Name() != "fcitx5" {
+		t.Errorf("Backend() = %v, %v, want fcitx5 from a fresh detection", backend, err)
+	}
+}
+
+func TestLinuxInputMethods(t *testing.T) {
+	testCases := []struct {
+		method  string
+		paths   []string
+		calls   []fakeCall
+		current string
+		sources []string
+		setTo   string
+	}{
+		{
+			method: "ibus",
+			paths:  []string{"ibus"},
+			calls: []fakeCall{
+				{cmd: "ibus engine", stdout: "xkb:us::eng\n"},
+				{cmd: "ibus list-engine", stdout: ibusEngines},
+				{cmd: "ibus engine hangul"},
+			},
+			current: "xkb:us::eng",
+			sources: []string{"xkb:us::eng", "hangul"},
+			setTo:   "hangul",
+		},
+		{
+			method: "fcitx",
+			paths:  []string{"fcitx-remote"},
+			calls: []fakeCall{
+				{cmd: "fcitx-remote -n", stdout: "fcitx-keyboard-us\n"},
+				{cmd: "fcitx-remote -l", stdout: "fcitx-keyboard-us\nmozc\n"},
+				{cmd: "fcitx-remote -l", stdout: "fcitx-keyboard-us\nmozc\n"},
+				{cmd: "fcitx-remote -s mozc"},
+			},
+			current: "fcitx-keyboard-us",
+			sources: []string{"fcitx-keyboard-us", "mozc"},
+			setTo:   "mozc",
+		},
+		{
+			method: "fcitx5",
+			paths:  []string{"fcitx5-remote"},
+			calls: []fakeCall{
+				{cmd: "fcitx5-remote -n", stdout: "keyboard-us\n"},
+				{cmd: "fcitx5-remote -l", stdout: "keyboard-us\n\nhangul\n"},
+				{cmd: "fcitx5-remote -l", stdout: "keyboard-us\n\nhangul\n"},
+				{cmd: "fcitx5-remote -s hangul"},
+			},
+			current: "keyboard-us",
+			sources: []string{"keyboard-us", "hangul"},
+			setTo:   "hangul",
+		},
+		{
+			method: "xkb",
+			paths:  []string{"setxkbmap"},
+			calls: []fakeCall{
+				{cmd: "setxkbmap -query", stdout: "rules:      evdev\nmodel:      pc105\nlayout:     us\n"},
+				{cmd: "setxkbmap kr"},
+			},
+			current: "us",
+			sources: []string{"us", "gb", "de", "fr", "es", "it", "ru", "cn", "jp", "kr"},
+			setTo:   "kr",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.method, func(t *testing.T) {
+			useFakeRunner(t, tc.paths, tc.calls...)
+			ctx := context.Background()
+			backend := Lookup(tc.method)
+			if backend == nil {
+				t.Fatalf("%s backend is not registered", tc.method)
+			}
+
+			if !backend.Available() {
+				t.Errorf("%s should be available when its tools are installed", tc.method)
+			}
+			if current, err := backend.Current(ctx); err != nil || current != tc.current {
+				t.Errorf("%s current input source = %q, %v, want %q", tc.method, current, err, tc.current)
+			}
+			if sources, err := backend.List(ctx); err != nil || !reflect.DeepEqual(sourceIDs(sources), tc.sources) {
+				t.Errorf("%s getAllInputSources = %v, %v, want %v", tc.method, sources, err, tc.sources)
+			}
+			if err := backend.Set(ctx, tc.setTo); err != nil {
+				t.Errorf("%s setInputSource(%q) failed: %v", tc.method, tc.setTo, err)
+			}
+		})
+	}
+}
+
+func TestLinuxEnabledSources(t *testing.T) {
+	testCases := []struct {
+		method   string
+		paths    []string
+		call     fakeCall
+		expected []string
+	}{
+		{
+			method:   "ibus",
+			paths:    []string{"ibus"},
+			call:     fakeCall{cmd: "gsettings get org.freedesktop.ibus.general preload-engines", stdout: "['xkb:us::eng', 'hangul']\n"},
+			expected: []string{"xkb:us::eng", "hangul"},
+		},
+		{
+			method: "ibus",
+			paths:  []string{"ibus"},
+			call:   fakeCall{cmd: "gsettings get org.freedesktop.ibus.general preload-engines", stdout: "@as []\n"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.method, func(t *testing.T) {
+			useFakeRunner(t, tc.paths, tc.call)
+
+			enabled, err := Lookup(tc.method).(EnabledLister).Enabled(context.Background())
+			if err != nil || !reflect.DeepEqual(enabled, tc.expected) {
+				t.Errorf("%s Enabled() = %v, %v, want %v", tc.method, enabled, err, tc.expected)
+			}
+		})
+	}
+
+	if _, ok := Lookup("xkb").(EnabledLister); ok {
+		t.Error("xkb should not list enabled sources, setxkbmap cannot switch between them")
+	}
+}
+
+func TestLinuxSetInputSourceErrors(t *testing.T) {
+	t.Run("unknown source", func(t *testing.T) {
+		useFakeRunner(t, []string{"fcitx5-remote"},
+			fakeCall{cmd: "fcitx5-remote -l", stdout: "keyboard-us\n"},
+		)
+
+		err := Lookup("fcitx5").Set(context.Background(), "nope")
+		if !errors.Is(err, ErrUnknownSource) {
+			t.Errorf("Expected ErrUnknownSource, got %v", err)
+		}
+	})
+
+	t.Run("unknown ibus engine", func(t *testing.T) {
+		useFakeRunner(t, []string{"ibus"},
+			fakeCall{cmd: "ibus engine hangl", stderr: "Failed to get engine", exitCode: 1},
+			fakeCall{cmd: "ibus list-engine", stdout: ibusEngines},
+		)
+
+		err := Lookup("ibus").Set(context.Background(), "hangl")
+		var e *Error
+		if !errors.As(err, &e) || e.Kind != ErrUnknownSource || !reflect.DeepEqual(e.Candidates, []string{"hangul"}) {
+			t.Errorf("Expected ErrUnknownSource suggesting hangul, got %v", err)
+		}
+	})
+
+	t.Run("unknown xkb layout", func(t *testing.T) {
+		useFakeRunner(t, []string{"setxkbmap"},
+			fakeCall{cmd: "setxkbmap qwfp", stderr: "Error loading new keyboard description", exitCode: 255},
+		)
+
+		if err := (xkbBackend{}).Set(context.Background(), "qwfp"); !errors.Is(err, ErrUnknownSource) {
+			t.Errorf("Expected ErrUnknownSource, got %v", err)
+		}
+	})
+
+	t.Run("xkb without a display", func(t *testing.T) {
+		useFakeRunner(t, []string{"setxkbmap"},
+			fakeCall{cmd: "setxkbmap us", stderr: `Cannot open display "default display"`, exitCode: 1},
+		)
+
+		if err := (xkbBackend{}).Set(context.Background(), "us"); !errors.Is(err, ErrCommandFailed) {
+			t.Errorf("Expected ErrCommandFailed, got %v", err)
+		}
+	})
+
+	t.Run("command failed", func(t *testing.T) {
+		useFakeRunner(t, []string{"ibus"},
+			fakeCall{cmd: "ibus engine", stderr: "Can't connect to IBus.", exitCode: 1},
+		)
+
+		_, err := Lookup("ibus").Current(context.Background())
+		if !errors.Is(err, ErrCommandFailed) {
+			t.Fatalf("Expected ErrCommandFailed, got %v", err)
+		}
+		var e *Error
+		if !errors.As(err, &e) || e.Detail != "Can't connect to IBus." {
+			t.Errorf("Expected stderr in error detail, got %v", err)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		useFakeRunner(t, []string{"ibus"},
+			fakeCall{cmd: "ibus engine", hang: true},
+		)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		if _, err := Lookup("ibus").Current(ctx); !errors.Is(err, ErrTimeout) {
+			t.Errorf("Expected ErrTimeout, got %v", err)
+		}
+	})
+
+	t.Run("xkb without setxkbmap", func(t *testing.T) {
+		useFakeRunner(t, nil)
+
+		if err := (xkbBackend{}).Set(context.Background(), "us"); !errors.Is(err, ErrBackendUnavailable) {
+			t.Errorf("Expected ErrBackendUnavailable, got %v", err)
+		}
+	})
+}
+
+func TestLinuxBackendUnavailable(t *testing.T) {
+	useFakeRunner(t, nil)
+
+	for _, backend := range Backends() {
+		if backend.Available() {
+			t.Errorf("%s should not be available without its tools", backend.Name())
+		}
+	}
+	if _, err := (xkbBackend{}).Current(context.Background()); !errors.Is(err, ErrBackendUnavailable) {
+		t.Errorf("xkb Current() should fail without setxkbmap, got %v", err)
+	}
+}
+
+func TestLinuxBackendRegistry(t *testing.T) {
+	expected := []string{"ibus", "fcitx5", "fcitx", "xkb"}
+	registered := Backends()
+
+	if len(registered) != len(expected) {
+		t.Fatalf("Expected %d backends, got %d", len(expected), len(registered))
+	}
+
+	for i, name := range expected {
+		if registered[i].Name() != name {
+			t.Errorf("Expected backend %s at index %d, got %s", name, i, registered[i].Name())
+		}
+		if Lookup(name) == nil {
+			t.Errorf("Lookup(%q) returned nil", name)
+		}
+	}
+}
+
+func TestXKBInputSources(t *testing.T) {
+	useFakeRunner(t, []string{"setxkbmap"})
+
+	sources, err := xkbBackend{}.List(context.Background())
+	if err != nil {
+		t.Fatalf("xkb List() returned error: %v", err)
+	}
+	expectedSources := []string{"us", "gb", "de", "fr", "es", "it", "ru", "cn", "jp", "kr"}
+
+	if len(sources) != len(expectedSources) {
+		t.Fatalf("Expected %d sources, got %d", len(expectedSources), len(sources))
+	}
+
+	for i, expected := range expectedSources {
+		if sources[i].ID != expected {
+			t.Errorf("Expected source %s at index %d, got %s", expected, i, sources[i].ID)
+		}
+	}
+
+	us := sources[0]
+	if us.Name != "English (US)" || us.Language != "en" || us.Layout != "us" || us.Kind != KindLayout || us.Backend != "xkb" {
+		t.Errorf("Unexpected details for us layout: %+v", us)
+	}
+}
+
+func TestParseIBusEngines(t *testing.T) {
+	output := "language: English\n  xkb:us:intl:eng - English (US, intl., with dead keys)\n" +
+		"language: Korean\n  hangul - Korean\n  xkb:kr:kr104:kor - Korean (101/104-key compatible)\n"
+
+	expected := []InputSource{
+		{ID: "xkb:us:intl:eng", Name: "English (US, intl., with dead keys)", Language: "en", Layout: "us", Variant: "intl", Backend: "ibus", Kind: KindLayout},
+		{ID: "hangul", Name: "Korean", Language: "ko", Backend: "ibus", Kind: KindInputMethod},
+		{ID: "xkb:kr:kr104:kor", Name: "Korean (101/104-key compatible)", Language: "ko", Layout: "kr", Variant: "kr104", Backend: "ibus", Kind: KindLayout},
+	}
+
+	if sources := parseIBusEngines(output); !reflect.DeepEqual(sources, expected) {
+		t.Errorf("parseIBusEngines() =\n%+v\nwant\n%+v", sources, expected)
+	}
+}
+
+// ibusListEngine is an excerpt of real ibus list-engine output, which lists
+// the XKB layouts of a language next to its engines.
+const ibusListEngine = `language: English
+  xkb:us::eng - English (US)
+  xkb:us:intl:eng - English (US, intl., with dead keys)
+language: Japanese
+  xkb:jp::jpn - Japanese
+  anthy - Anthy
+  mozc-jp - Mozc
+language: Korean
+  xkb:kr:kr104:kor - Korean (101/104-key compatible)
+  hangul - Korean
+`
+
+func TestResolveIBusEngines(t *testing.T) {
+	sources := parseIBusEngines(ibusListEngine)
+
+	testCases := []struct {
+		query string
+		id    string
+		err   error
+	}{
+		{"korean", "hangul", nil},
+		{"ko", "hangul", nil},
+		{"Korean (101/104-key compatible)", "xkb:kr:kr104:kor", nil},
+		{"ja", "", ErrAmbiguousSource},
+		{"en", "", ErrAmbiguousSource},
+		{"intl", "xkb:us:intl:eng", nil},
+	}
+
+	for _, tc := range testCases {
+		source, err := ResolveSource(sources, tc.query)
+		if !errors.Is(err, tc.err) || source.ID != tc.id {
+			t.Errorf("ResolveSource(%q) = %q, %v, want %q, %v", tc.query, source.ID, err, tc.id, tc.err)
+		}
+	}
+}
+
+func TestFcitxSource(t *testing.T) {
+	testCases := []struct {
+		id       string
+		expected InputSource
+	}{
+		{"keyboard-us", InputSource{ID: "keyboard-us", Name: "English (US)", Language: "en", Layout: "us", Backend: "fcitx5", Kind: KindLayout}},
+		{"keyboard-de-nodeadkeys", InputSource{ID: "keyboard-de-nodeadkeys", Name: "German (nodeadkeys)", Language: "de", Layout: "de", Variant: "nodeadkeys", Backend: "fcitx5", Kind: KindLayout}},
+		{"fcitx-keyboard-kr", InputSource{ID: "fcitx-keyboard-kr", Name: "Korean", Language: "ko", Layout: "kr", Backend: "fcitx5", Kind: KindLayout}},
+		{"mozc", InputSource{ID: "mozc", Name: "Mozc", Language: "ja", Backend: "fcitx5", Kind: KindInputMethod}},
+		{"custom-im", InputSource{ID: "custom-im", Backend: "fcitx5", Kind: KindInputMethod}},
+	}
+
+	for _, tc := range testCases {
+		if got := fcitxSource("fcitx5", tc.id); got != tc.expected {
+			t.Errorf("fcitxSource(%q) = %+v, want %+v", tc.id, got, tc.expected)
+		}
+	}
+}
+
+func TestLinuxEvents(t *testing.T) {
+	const (
+		ibusRule  = "type='signal',interface='org.freedesktop.IBus',member='GlobalEngineChanged'"
+		fcitxRule = "type='signal',interface='org.fcitx.Fcitx.InputContext1',member='CurrentIM'"
+		monitor   = "signal time=1.0 sender=:1.5 -> destination=(null destination) serial=4 path=/org/freedesktop/IBus; interface=org.freedesktop.IBus; member="
+	)
+	testCases := []struct {
+		name    string
+		backend EventSource
+		calls   []fakeCall
+	}{
+		{
+			name:    "ibus",
+			backend: ibusBackend{},
+			calls: []fakeCall{
+				{cmd: "ibus address", stdout: "unix:path=/tmp/ibus\n"},
+				{cmd: "dbus-monitor --address unix:path=/tmp/ibus " + ibusRule, stdout: monitor + "NameAcquired\n" + monitor + "GlobalEngineChanged\n   string \"hangul\"\n"},
+			},
+		},
+		{
+			name:    "fcitx5",
+			backend: fcitxBackend{name: "fcitx5", remote: "fcitx5-remote"},
+			calls: []fakeCall{
+				{cmd: "dbus-monitor --session " + fcitxRule, stdout: monitor + "CurrentIM\n"},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			useFakeRunner(t, []string{"dbus-monitor"}, tc.calls...)
+
+			events, err := tc.backend.Events(context.Background())
+			if err != nil {
+				t.Fatalf("Events() returned error: %v", err)
+			}
+			count := 0
+			for range events {
+				count++
+			}
+			if count != 1 {
+				t.Errorf("Expected 1 event, got %d", count)
+			}
+		})
+	}
+}
+
+func TestLinuxEventsUnavailable(t *testing.T) {
+	useFakeRunner(t, nil)
+
+	if _, err := (fcitxBackend{name: "fcitx", remote: "fcitx-remote"}).Events(context.Background()); !errors.Is(err, ErrBackendUnavailable) {
+		t.Errorf("fcitx Events() should be unavailable, got %v", err)
+	}
+	if _, err := (fcitxBackend{name: "fcitx5", remote: "fcitx5-remote"}).Events(context.Background()); !errors.Is(err, ErrBackendUnavailable) {
+		t.Errorf("Events() without dbus-monitor should be unavailable, got %v", err)
+	}
+}
@@ -1,9 +1,11 @@
 //go:build windows
 
-package main
+package imswitch
 
 import (
+	"context"
 	"fmt"
+	"runtime"
 	"strings"
 	"syscall"
 	"time"
@@ -67,6 +69,21 @@ var layoutNames = map[uint32]string{
 	0x0419: "ru-RU", // Russian
 }
 
+// Display names for the layouts in layoutNames
+var layoutDescriptions = map[string]string{
+	"en-US": "English (United States)",
+	"en-GB": "English (United Kingdom)",
+	"de-DE": "German (Germany)",
+	"fr-FR": "French (France)",
+	"it-IT": "Italian (Italy)",
+	"es-ES": "Spanish (Spain)",
+	"ja-JP": "Japanese",
+	"ko-KR": "Korean",
+	"zh-CN": "Chinese (Simplified)",
+	"zh-TW": "Chinese (Traditional)",
+	"ru-RU": "Russian",
+}
+
 // CJK language codes that should have IME enabled
 var cjkLanguages = map[string]bool{
 	"ja-JP": true, // Japanese
@@ -75,7 +92,91 @@ var cjkLanguages = map[string]bool{
 	"zh-TW": true, // Chinese (Traditional)
 }
 
-func getCurrentInputSource() string {
+func init() {
+	Register(imeBackend{}, 10)
+}
+
+// detectInputMethod always selects the IME backend on Windows
+func detectInputMethod(ctx context.Context) (string, error) {
+	return "windows", nil
+}
+
+// explain reports the only backend supported on this platform.
+func explain(ctx context.Context) (DetectionReport, error) {
+	var report DetectionReport
+	report.beginProbe("platform")
+	report.observe("GOOS=%s", runtime.GOOS)
+	report.finish("windows")
+	return report, nil
+}
+
+// platformChecks has nothing to inspect beyond the backend itself here.
+func platformChecks(ctx context.Context, backend string) []Check {
+	return nil
+}
+
+// imeBackend reports keyboard layouts and toggles the IME open status.
+type imeBackend struct{}
+
+func (imeBackend) Name() string { return "windows" }
+
+func (imeBackend) Available() bool { return true }
+
+func (b imeBackend) Current(ctx context.Context) (string, error) {
+	current := getCurrentLayout()
+	if current == "" {
+		return "", &Error{Kind: ErrCommandFailed, Backend: b.Name(), Detail: "could not read the foreground keyboard layout"}
+	}
+	return current, nil
+}
+
+func (b imeBackend) List(ctx context.Context) ([]InputSource, error) {
+	layouts := getAllLayouts()
+	if layouts == nil {
+		return nil, &Error{Kind: ErrCommandFailed, Backend: b.Name(), Detail: "could not read the keyboard layout list"}
+	}
+
+	sources := make([]InputSource, 0, len(layouts))
+	for _, id := range layouts {
+		sources = append(sources, windowsSource(id))
+	}
+	return sources, nil
+}
+
+// Enabled returns the listed layouts, since Windows only loads the layouts
+// the user added in the language settings.
+func (b imeBackend) Enabled(ctx context.Context) ([]string, error) {
+	sources, err := b.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return sourceIDs(sources), nil
+}
+
+// windowsSource describes a layout returned by getLayoutName. Layouts
+// missing from layoutNames are reported by their hex language ID only.
+func windowsSource(id string) InputSource {
+	source := InputSource{ID: id, Backend: "windows", Kind: KindLayout}
+	if name, ok := layoutDescriptions[id]; ok {
+		source.Name = name
+		source.Language = id
+	}
+	if cjkLanguages[id] {
+		source.Kind = KindInputMethod
+	}
+	return source
+}
+
+func (b imeBackend) Set(ctx context.Context, sourceID string) error {
+	// On Windows, we don't change the keyboard layout
+	// Instead, we control the IME status based on the source language
+	if !setIMEStatus(sourceID) {
+		return &Error{Kind: ErrCommandFailed, Backend: b.Name(), Source: sourceID, Detail: "could not change the IME status"}
+	}
+	return nil
+}
+
+func getCurrentLayout() string {
 	foregroundWnd, _, _ := getForegroundWindow.Call()
 	if foregroundWnd == 0 {
 		return ""
@@ -108,7 +209,7 @@ func getLayoutName(hkl HKL) string {
 	return fmt.Sprintf("%04X", langId)
 }
 
-func getAllInputSources() []string {
+func getAllLayouts() []string {
 	count, _, _ := getKeyboardLayoutList.Call(0, 0)
 	if count == 0 {
 		return nil
@@ -138,47 +239,64 @@ func getAllInputSources() []string {
 	return sources
 }
 
-func setInputSource(sourceID string) bool {
-	// On Windows, we don't change the keyboard layout
-	// Instead, we control the IME status based on the source language
-	return setIMEStatus(sourceID)
+// Verify checks the IME open status, since Set leaves the layout that
+// Current reports unchanged.
+func (b imeBackend) Verify(ctx context.Context, sourceID string) (string, bool, error) {
+	status := getDetailedIMEStatus()
+	if status == "Unknown" {
+		return "", false, &Error{Kind: ErrCommandFailed, Backend: b.Name(), Source: sourceID, Detail: "could not read the IME status"}
+	}
+	actual := fmt.Sprintf("%s (IME %s)", getCurrentLayout(), status)
+	return actual, (status == "open") == isCJKSource(sourceID), nil
+}
+
+// Toggles reports that Set presses the IME toggle key, which a second press
+// would undo before the first one lands.
+func (b imeBackend) Toggles() bool {
+	return true
 }
 
 func setIMEStatus(sourceID string) bool {
-	// Determine if the source is a CJK language
-	isCJK := cjkLanguages[sourceID]
+	return setIMEOpenStatus(isCJKSource(sourceID))
+}
+
+// isCJKSource reports whether sourceID needs the IME open.
+func isCJKSource(sourceID string) bool {
+	if cjkLanguages[sourceID] {
+		return true
+	}
 
 	// Also check for partial matches (e.g., "ja" for Japanese)
-	if !isCJK {
-		for lang := range cjkLanguages {
-			if strings.HasPrefix(sourceID, strings.Split(lang, "-")[0]) {
-				isCJK = true
-				break
-			}
+	for lang := range cjkLanguages {
+		if strings.HasPrefix(sourceID, strings.Split(lang, "-")[0]) {
+			return true
 		}
 	}
-
-	return setIMEOpenStatus(isCJK)
+	return false
 }
 
+// setIMEOpenStatus opens or closes the IME of the foreground window. The key
+// press that toggles it is applied asynchronously, so success means the IME
+// was already in the requested state or the key press was sent; WithVerify
+// reads the status back.
 func setIMEOpenStatus(open bool) bool {
 	isOpen := getDetailedIMEStatus() == "open"
-
-	currentInputSource := getCurrentInputSource()
-
-	if (open && !isOpen) || (!open && isOpen) {
-		if currentInputSource == "ja-JP" {
-			toggleJapanese()
-		}
-		if currentInputSource == "ko-KR" {
-			toggleKorean()
-		}
-		if currentInputSource == "zh-CN" || currentInputSource == "zh-TW" {
-			toggleChinese()
-		}
+	if isOpen == open {
+		return true
 	}
 
-	return isOpen == open
+	switch getCurrentLayout() {
+	case "ja-JP":
+		toggleJapanese()
+	case "ko-KR":
+		toggleKorean()
+	case "zh-CN", "zh-TW":
+		toggleChinese()
+	default:
+		// No key toggles the IME for this layout.
+		return false
+	}
+	return true
 }
 
 func getDetailedIMEStatus() string {
@@ -0,0 +1,178 @@
+package imswitch
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// maxSuggestions bounds the "did you mean" list of an unknown source.
+const maxSuggestions = 3
+
+// Resolve finds the input source that query refers to. Besides an exact ID it
+// accepts a unique case-insensitive match of an ID, then of a display name,
+// then of a language, given as a tag such as "ko" or a name such as "korean",
+// and finally a unique substring of an ID or display name. A language shared
+// by one input method and some keyboard layouts resolves to the input method.
+//
+// When several sources match equally well, Resolve fails with
+// ErrAmbiguousSource and lists them in the error's Candidates. When none
+// match, it fails with ErrUnknownSource and suggests the nearest IDs.
+func (s *Switcher) Resolve(ctx context.Context, query string) (InputSource, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	backend, err := s.resolve(ctx)
+	if err != nil {
+		return InputSource{}, err
+	}
+	sources, err := backend.List(ctx)
+	if err != nil {
+		return InputSource{}, err
+	}
+	return resolveSource(backend.Name(), sources, query)
+}
+
+// ResolveSource is Resolve over an already listed set of sources.
+func ResolveSource(sources []InputSource, query string) (InputSource, error) {
+	backend := ""
+	if len(sources) > 0 {
+		backend = sources[0].Backend
+	}
+	return resolveSource(backend, sources, query)
+}
+
+func resolveSource(backend string, sources []InputSource, query string) (InputSource, error) {
+	if source, ok := findSource(sources, query); ok {
+		return source, nil
+	}
+
+	q := strings.ToLower(strings.TrimSpace(query))
+	tiers := []struct {
+		matches func(InputSource) bool
+		// preferInputMethods settles a tie between an input method and
+		// keyboard layouts for the same language, such as IBus hangul and
+		// xkb:kr:kr104:kor, in favor of the input method.
+		preferInputMethods bool
+	}{
+		{matches: func(source InputSource) bool {
+			return strings.ToLower(source.ID) == q
+		}},
+		{matches: func(source InputSource) bool {
+			return strings.ToLower(source.Name) == q
+		}},
+		{matches: func(source InputSource) bool {
+			return matchesLanguage(source.Language, q)
+		}, preferInputMethods: true},
+		{matches: func(source InputSource) bool {
+			return strings.Contains(strings.ToLower(source.ID), q) ||
+				strings.Contains(strings.ToLower(source.Name), q)
+		}},
+	}
+	for _, tier := range tiers {
+		if q == "" {
+			// Every source contains the empty string.
+			break
+		}
+		var found, inputMethods []InputSource
+		for _, source := range sources {
+			if tier.matches(source) {
+				found = append(found, source)
+				if source.Kind == KindInputMethod {
+					inputMethods = append(inputMethods, source)
+				}
+			}
+		}
+		if tier.preferInputMethods && len(inputMethods) == 1 {
+			return inputMethods[0], nil
+		}
+		switch {
+		case len(found) == 1:
+			return found[0], nil
+		case len(found) > 1:
+			ids := sourceIDs(found)
+			return InputSource{}, &Error{
+				Kind:       ErrAmbiguousSource,
+				Backend:    backend,
+				Source:     query,
+				Detail:     "matches " + strings.Join(ids, ", "),
+				Candidates: ids,
+			}
+		}
+	}
+
+	return InputSource{}, unknownSourceError(backend, sources, query)
+}
+
+// unknownSourceError reports that query matches none of sources, suggesting
+// the nearest IDs.
+func unknownSourceError(backend string, sources []InputSource, query string) *Error {
+	err := &Error{Kind: ErrUnknownSource, Backend: backend, Source: query}
+	if suggestions := suggestSources(sources, strings.ToLower(strings.TrimSpace(query))); len(suggestions) > 0 {
+		err.Detail = fmt.Sprintf("did you mean %s?", strings.Join(suggestions, " or "))
+		err.Candidates = suggestions
+	}
+	return err
+}
+
+// matchesLanguage reports whether q names the language of tag, either as a
+// tag ("ko", "ko-KR") or as an English name ("korean").
+func matchesLanguage(tag, q string) bool {
+	if tag == "" {
+		return false
+	}
+	tag = strings.ToLower(tag)
+	base, _, _ := strings.Cut(tag, "-")
+	return q == tag || q == base || languageNames[q] == base
+}
+
+// suggestSources returns the IDs of the sources whose ID or display name is
+// closest to q, nearest first, ignoring those too far off to be a typo.
+func suggestSources(sources []InputSource, q string) []string {
+	type scored struct {
+		id       string
+		distance int
+	}
+	limit := max(2, len(q)/3)
+
+	var near []scored
+	for _, source := range sources {
+		distance := editDistance(q, strings.ToLower(source.ID))
+		if source.Name != "" {
+			distance = min(distance, editDistance(q, strings.ToLower(source.Name)))
+		}
+		if distance <= limit {
+			near = append(near, scored{source.ID, distance})
+		}
+	}
+	sort.SliceStable(near, func(i, j int) bool { return near[i].distance < near[j].distance })
+
+	var ids []string
+	for _, n := range near[:min(len(near), maxSuggestions)] {
+		ids = append(ids, n.id)
+	}
+	return ids
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	ar, br := []rune(a), []rune(b)
+	prev := make([]int, len(br)+1)
+	curr := make([]int, len(br)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ar); i++ {
+		curr[0] = i
+		for j := 1; j <= len(br); j++ {
+			cost := 1
+			if ar[i-1] == br[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(br)]
+}
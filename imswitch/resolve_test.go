@@ -0,0 +1,116 @@
+package imswitch
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestResolveSource(t *testing.T) {
+	ibus := []InputSource{
+		{ID: "xkb:us::eng", Name: "English (US)", Language: "en", Backend: "ibus"},
+		{ID: "xkb:de::ger", Name: "German", Language: "de", Backend: "ibus"},
+		{ID: "hangul", Name: "Hangul", Language: "ko", Backend: "ibus"},
+		{ID: "mozc-jp", Name: "Mozc", Language: "ja", Backend: "ibus"},
+		{ID: "anthy", Name: "Anthy", Language: "ja", Backend: "ibus"},
+	}
+	macos := []InputSource{
+		{ID: "com.apple.keylayout.ABC", Name: "ABC", Language: "en", Backend: "macos"},
+		{ID: "com.apple.inputmethod.Korean.2SetKorean", Name: "2-Set Korean", Language: "ko", Backend: "macos"},
+	}
+
+	testCases := []struct {
+		name       string
+		sources    []InputSource
+		query      string
+		id         string
+		err        error
+		candidates []string
+	}{
+		{"exact ID", ibus, "hangul", "hangul", nil, nil},
+		{"ID ignoring case", ibus, "HANGUL", "hangul", nil, nil},
+		{"display name", ibus, "german", "xkb:de::ger", nil, nil},
+		{"language name", ibus, "korean", "hangul", nil, nil},
+		{"language tag", ibus, "en", "xkb:us::eng", nil, nil},
+		{"substring", ibus, "mozc", "mozc-jp", nil, nil},
+		{"language name on macOS", macos, "korean", "com.apple.inputmethod.Korean.2SetKorean", nil, nil},
+		{"substring on macOS", macos, "abc", "com.apple.keylayout.ABC", nil, nil},
+		{"ambiguous language", ibus, "japanese", "", ErrAmbiguousSource, []string{"mozc-jp", "anthy"}},
+		{"ambiguous substring", ibus, "xkb", "", ErrAmbiguousSource, []string{"xkb:us::eng", "xkb:de::ger"}},
+		{"typo", ibus, "hangl", "", ErrUnknownSource, []string{"hangul"}},
+		{"no match", ibus, "klingon", "", ErrUnknownSource, nil},
+		{"empty", ibus, "", "", ErrUnknownSource, nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			source, err := ResolveSource(tc.sources, tc.query)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("ResolveSource(%q) = %+v, %v, want %v", tc.query, source, err, tc.err)
+			}
+			if source.ID != tc.id {
+				t.Errorf("ResolveSource(%q) = %q, want %q", tc.query, source.ID, tc.id)
+			}
+			var e *Error
+			if err != nil && errors.As(err, &e) && !reflect.DeepEqual(e.Candidates, tc.candidates) {
+				t.Errorf("ResolveSource(%q) candidates = %v, want %v", tc.query, e.Candidates, tc.candidates)
+			}
+		})
+	}
+}
+
+func TestResolveSourceMessages(t *testing.T) {
+	sources := []InputSource{
+		{ID: "hangul", Name: "Hangul", Language: "ko", Backend: "ibus"},
+		{ID: "mozc-jp", Name: "Mozc", Language: "ja", Backend: "ibus"},
+		{ID: "anthy", Name: "Anthy", Language: "ja", Backend: "ibus"},
+	}
+
+	testCases := []struct {
+		query    string
+		expected string
+	}{
+		{"hangl", "ibus: unknown input source 'hangl': did you mean hangul?"},
+		{"japanese", "ibus: ambiguous input source 'japanese': matches mozc-jp, anthy"},
+		{"klingon", "ibus: unknown input source 'klingon'"},
+	}
+
+	for _, tc := range testCases {
+		if _, err := ResolveSource(sources, tc.query); err == nil || err.Error() != tc.expected {
+			t.Errorf("ResolveSource(%q) error = %v, want %q", tc.query, err, tc.expected)
+		}
+	}
+}
+
+func TestSwitcherResolve(t *testing.T) {
+	withBackends(t)
+	t.Setenv(BackendEnvVar, "")
+
+	Register(stubBackend{name: "a", sources: []string{"a-us", "a-ko"}}, 10)
+
+	source, err := New(WithBackend("a")).Resolve(context.Background(), "KO")
+	if err != nil || source.ID != "a-ko" {
+		t.Errorf("Resolve(KO) = %+v, %v, want a-ko", source, err)
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	testCases := []struct {
+		a, b     string
+		distance int
+	}{
+		{"", "", 0},
+		{"hangul", "hangul", 0},
+		{"hangl", "hangul", 1},
+		{"", "abc", 3},
+		{"kitten", "sitting", 3},
+		{"한글", "한굴", 1},
+	}
+
+	for _, tc := range testCases {
+		if got := editDistance(tc.a, tc.b); got != tc.distance {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tc.a, tc.b, got, tc.distance)
+		}
+	}
+}
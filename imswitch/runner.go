@@ -0,0 +1,107 @@
+package imswitch
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// commandRunner executes the external tools that backends depend on. Backends
+// go through the package-level runner rather than os/exec so that tests can
+// substitute a scripted fake.
+type commandRunner interface {
+	// Run executes name with args and returns its stdout. A non-zero exit
+	// status is reported as a *commandError. When ctx is done the process is
+	// killed and ctx.Err() is returned.
+	Run(ctx context.Context, name string, args ...string) ([]byte, error)
+	// Stream starts name with args and returns its stdout line by line. The
+	// channel is closed when the command exits; when ctx is done the process
+	// is killed.
+	Stream(ctx context.Context, name string, args ...string) (<-chan string, error)
+	// LookPath reports whether name is an executable on PATH.
+	LookPath(name string) bool
+}
+
+var runner commandRunner = execRunner{}
+
+// commandError describes an external command that ran but failed.
+type commandError struct {
+	Name     string
+	Args     []string
+	ExitCode int
+	Stderr   string
+}
+
+func (e *commandError) Error() string {
+	msg := fmt.Sprintf("%s exited with status %d", strings.Join(append([]string{e.Name}, e.Args...), " "), e.ExitCode)
+	if e.Stderr != "" {
+		msg += ": " + e.Stderr
+	}
+	return msg
+}
+
+type execRunner struct{}
+
+// waitDelay bounds how long a killed command may keep its output pipes open,
+// e.g. when it left a child process behind.
+const waitDelay = 50 * time.Millisecond
+
+func (execRunner) Run(ctx context.Context, name string, args ...string) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stderr = &stderr
+	cmd.WaitDelay = waitDelay
+
+	output, err := cmd.Output()
+	if err != nil && ctx.Err() != nil {
+		return output, ctx.Err()
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return output, &commandError{
+			Name:     name,
+			Args:     args,
+			ExitCode: exitErr.ExitCode(),
+			Stderr:   strings.TrimSpace(stderr.String()),
+		}
+	}
+	return output, err
+}
+
+func (execRunner) Stream(ctx context.Context, name string, args ...string) (<-chan string, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.WaitDelay = waitDelay
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		defer cmd.Wait()
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			select {
+			case lines <- scanner.Text():
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return lines, nil
+}
+
+func (execRunner) LookPath(name string) bool {
+	_, err := exec.LookPath(name)
+	return err == nil
+}
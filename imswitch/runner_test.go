@@ -0,0 +1,228 @@
+package imswitch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeCall is one scripted command invocation. cmd is split on whitespace
+// into the expected argv.
+type fakeCall struct {
+	cmd      string
+	stdout   string
+	stderr   string
+	exitCode int
+	// hang makes the call block until its context is done, like a wedged daemon.
+	hang bool
+}
+
+// fakeRunner replays scripted calls in order and fails the test when a
+// backend runs anything else.
+type fakeRunner struct {
+	t     *testing.T
+	calls []fakeCall
+	paths map[string]bool
+}
+
+func (f *fakeRunner) Run(ctx context.Context, name string, args ...string) ([]byte, error) {
+	f.t.Helper()
+	argv := append([]string{name}, args...)
+	if len(f.calls) == 0 {
+		f.t.Errorf("Unexpected command: %s", strings.Join(argv, " "))
+		return nil, &commandError{Name: name, Args: args, ExitCode: 127}
+	}
+
+	call := f.calls[0]
+	f.calls = f.calls[1:]
+	if want := strings.Fields(call.cmd); !reflect.DeepEqual(argv, want) {
+		f.t.Errorf("Expected command %q, got %q", call.cmd, strings.Join(argv, " "))
+	}
+	if call.hang {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	if call.exitCode != 0 {
+		return []byte(call.stdout), &commandError{Name: name, Args: args, ExitCode: call.exitCode, Stderr: call.stderr}
+	}
+	return []byte(call.stdout), nil
+}
+
+// Stream replays the next scripted call as a stream of its stdout lines. A
+// hanging call keeps the stream open until ctx is done.
+func (f *fakeRunner) Stream(ctx context.Context, name string, args ...string) (<-chan string, error) {
+	f.t.Helper()
+	argv := append([]string{name}, args...)
+	if len(f.calls) == 0 {
+		f.t.Errorf("Unexpected command: %s", strings.Join(argv, " "))
+		return nil, &commandError{Name: name, Args: args, ExitCode: 127}
+	}
+
+	call := f.calls[0]
+	f.calls = f.calls[1:]
+	if want := strings.Fields(call.cmd); !reflect.DeepEqual(argv, want) {
+		f.t.Errorf("Expected command %q, got %q", call.cmd, strings.Join(argv, " "))
+	}
+	if call.exitCode != 0 {
+		return nil, &commandError{Name: name, Args: args, ExitCode: call.exitCode, Stderr: call.stderr}
+	}
+
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		for _, line := range strings.Split(call.stdout, "\n") {
+			if line == "" {
+				continue
+			}
+			select {
+			case lines <- line:
+			case <-ctx.Done():
+				return
+			}
+		}
+		if call.hang {
+			<-ctx.Done()
+		}
+	}()
+	return lines, nil
+}
+
+func (f *fakeRunner) LookPath(name string) bool {
+	return f.paths[name]
+}
+
+// useFakeRunner installs a fakeRunner for the duration of the test. paths
+// lists the commands that LookPath reports as installed.
+func useFakeRunner(t *testing.T, paths []string, calls ...fakeCall) *fakeRunner {
+	t.Helper()
+	fake := &fakeRunner{t: t, calls: calls, paths: map[string]bool{}}
+	for _, path := range paths {
+		fake.paths[path] = true
+	}
+
+	saved := runner
+	runner = fake
+	t.Cleanup(func() {
+		runner = saved
+		for _, call := range fake.calls {
+			t.Errorf("Expected command was not run: %s", call.cmd)
+		}
+	})
+	return fake
+}
+
+// TestHelperProcess is not a real test; execRunner tests re-run the test
+// binary with it to get a portable child process.
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv("IM_SWITCH_HELPER_PROCESS") != "1" {
+		return
+	}
+	fmt.Fprint(os.Stdout, os.Getenv("IM_SWITCH_HELPER_STDOUT"))
+	fmt.Fprint(os.Stderr, os.Getenv("IM_SWITCH_HELPER_STDERR"))
+	if d, err := time.ParseDuration(os.Getenv("IM_SWITCH_HELPER_SLEEP")); err == nil {
+		time.Sleep(d)
+	}
+	if os.Getenv("IM_SWITCH_HELPER_FAIL") == "1" {
+		os.Exit(3)
+	}
+	os.Exit(0)
+}
+
+func TestExecRunner(t *testing.T) {
+	t.Setenv("IM_SWITCH_HELPER_PROCESS", "1")
+	t.Setenv("IM_SWITCH_HELPER_STDOUT", "hangul\n")
+	t.Setenv("IM_SWITCH_HELPER_STDERR", "")
+
+	output, err := execRunner{}.Run(context.Background(), os.Args[0], "-test.run=TestHelperProcess")
+	if err != nil {
+		t.Fatalf("Run() returned error: %v", err)
+	}
+	if string(output) != "hangul\n" {
+		t.Errorf("Expected stdout %q, got %q", "hangul\n", output)
+	}
+}
+
+func TestExecRunnerFailure(t *testing.T) {
+	t.Setenv("IM_SWITCH_HELPER_PROCESS", "1")
+	t.Setenv("IM_SWITCH_HELPER_STDERR", "engine not found\n")
+	t.Setenv("IM_SWITCH_HELPER_FAIL", "1")
+
+	_, err := execRunner{}.Run(context.Background(), os.Args[0], "-test.run=TestHelperProcess")
+	var cmdErr *commandError
+	if !errors.As(err, &cmdErr) {
+		t.Fatalf("Expected *commandError, got %v", err)
+	}
+	if cmdErr.ExitCode != 3 {
+		t.Errorf("Expected exit code 3, got %d", cmdErr.ExitCode)
+	}
+	if cmdErr.Stderr != "engine not found" {
+		t.Errorf("Expected trimmed stderr, got %q", cmdErr.Stderr)
+	}
+}
+
+func TestExecRunnerTimeout(t *testing.T) {
+	t.Setenv("IM_SWITCH_HELPER_PROCESS", "1")
+	t.Setenv("IM_SWITCH_HELPER_SLEEP", "10s")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := execRunner{}.Run(ctx, os.Args[0], "-test.run=TestHelperProcess")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected context.DeadlineExceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Run() should kill the process on timeout, took %s", elapsed)
+	}
+	if !errors.Is(commandFailure("ibus", "", err), ErrTimeout) {
+		t.Error("commandFailure() should map a deadline to ErrTimeout")
+	}
+}
+
+func TestExecRunnerStream(t *testing.T) {
+	t.Setenv("IM_SWITCH_HELPER_PROCESS", "1")
+	t.Setenv("IM_SWITCH_HELPER_STDOUT", "first\nsecond\n")
+
+	lines, err := execRunner{}.Stream(context.Background(), os.Args[0], "-test.run=TestHelperProcess")
+	if err != nil {
+		t.Fatalf("Stream() returned error: %v", err)
+	}
+	var got []string
+	for line := range lines {
+		got = append(got, line)
+	}
+	if want := []string{"first", "second"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected lines %q, got %q", want, got)
+	}
+}
+
+func TestExecRunnerStreamCancel(t *testing.T) {
+	t.Setenv("IM_SWITCH_HELPER_PROCESS", "1")
+	t.Setenv("IM_SWITCH_HELPER_SLEEP", "10s")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	lines, err := execRunner{}.Stream(ctx, os.Args[0], "-test.run=TestHelperProcess")
+	if err != nil {
+		t.Fatalf("Stream() returned error: %v", err)
+	}
+	for range lines {
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Stream() should kill the process when ctx is done, took %s", elapsed)
+	}
+}
+
+func TestExecRunnerLookPath(t *testing.T) {
+	if (execRunner{}).LookPath("nonexistent-command-12345") {
+		t.Error("LookPath() should return false for a missing command")
+	}
+}
@@ -0,0 +1,134 @@
+package imswitch
+
+import "strings"
+
+// SourceKind tells keyboard layouts apart from input method engines.
+type SourceKind string
+
+const (
+	// KindLayout is a plain keyboard layout such as US or German.
+	KindLayout SourceKind = "layout"
+	// KindInputMethod is an IME engine such as Hangul, Mozc or Pinyin.
+	KindInputMethod SourceKind = "input-method"
+)
+
+// InputSource describes an input source as reported by its backend. Fields
+// other than ID and Backend are best effort and may be empty.
+type InputSource struct {
+	// ID is the identifier passed to Set, e.g. "xkb:us::eng".
+	ID string `json:"id"`
+	// Name is a human-readable name, e.g. "English (US)".
+	Name string `json:"name"`
+	// Language is a BCP 47 language tag, e.g. "en" or "ko-KR".
+	Language string `json:"language"`
+	// Layout and Variant are the XKB layout and variant, if known.
+	Layout  string `json:"layout,omitempty"`
+	Variant string `json:"variant,omitempty"`
+	// Backend is the name of the backend that owns the source.
+	Backend string `json:"backend"`
+	// Kind is KindLayout or KindInputMethod, if known.
+	Kind SourceKind `json:"kind"`
+}
+
+// sourceIDs returns the IDs of sources, in order.
+func sourceIDs(sources []InputSource) []string {
+	ids := make([]string, 0, len(sources))
+	for _, source := range sources {
+		ids = append(ids, source.ID)
+	}
+	return ids
+}
+
+// findSource returns the source with the given ID.
+func findSource(sources []InputSource, id string) (InputSource, bool) {
+	for _, source := range sources {
+		if source.ID == id {
+			return source, true
+		}
+	}
+	return InputSource{}, false
+}
+
+// xkbLayouts describes common XKB layouts by name and language.
+var xkbLayouts = map[string]struct {
+	name     string
+	language string
+}{
+	"us": {"English (US)", "en"},
+	"gb": {"English (UK)", "en"},
+	"de": {"German", "de"},
+	"fr": {"French", "fr"},
+	"es": {"Spanish", "es"},
+	"it": {"Italian", "it"},
+	"ru": {"Russian", "ru"},
+	"cn": {"Chinese", "zh"},
+	"jp": {"Japanese", "ja"},
+	"kr": {"Korean", "ko"},
+}
+
+// knownEngines describes common IME engines shared by IBus and Fcitx.
+var knownEngines = map[string]struct {
+	name     string
+	language string
+}{
+	"hangul":    {"Hangul", "ko"},
+	"anthy":     {"Anthy", "ja"},
+	"mozc":      {"Mozc", "ja"},
+	"mozc-jp":   {"Mozc", "ja"},
+	"kkc":       {"Kana Kanji", "ja"},
+	"pinyin":    {"Pinyin", "zh"},
+	"libpinyin": {"Intelligent Pinyin", "zh"},
+	"rime":      {"Rime", "zh"},
+	"chewing":   {"Chewing", "zh-TW"},
+	"unikey":    {"Unikey", "vi"},
+	"bamboo":    {"Bamboo", "vi"},
+}
+
+// languageNames maps the language names IBus prints to language tags.
+var languageNames = map[string]string{
+	"english":    "en",
+	"korean":     "ko",
+	"japanese":   "ja",
+	"chinese":    "zh",
+	"german":     "de",
+	"french":     "fr",
+	"spanish":    "es",
+	"italian":    "it",
+	"russian":    "ru",
+	"vietnamese": "vi",
+}
+
+// languageCode returns the language tag for a language name such as
+// "English", or "" if it is not known.
+func languageCode(name string) string {
+	return languageNames[strings.ToLower(strings.TrimSpace(name))]
+}
+
+// layoutSource describes an XKB layout, optionally with a variant.
+func layoutSource(backend, id, layout, variant string) InputSource {
+	source := InputSource{
+		ID:      id,
+		Layout:  layout,
+		Variant: variant,
+		Backend: backend,
+		Kind:    KindLayout,
+	}
+	if info, ok := xkbLayouts[layout]; ok {
+		source.Name = info.name
+		source.Language = info.language
+		if variant != "" {
+			source.Name += " (" + variant + ")"
+		}
+	}
+	return source
+}
+
+// engineSource describes an IME engine using the knownEngines table.
+func engineSource(backend, id string) InputSource {
+	source := InputSource{ID: id, Backend: backend, Kind: KindInputMethod}
+	if info, ok := knownEngines[id]; ok {
+		source.Name = info.name
+		source.Language = info.language
+	}
+	return source
+}
@@ -0,0 +1,274 @@
+package imswitch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultTimeout bounds each Switcher operation unless WithTimeout says
+// otherwise.
+const DefaultTimeout = 500 * time.Millisecond
+
+// Switcher reads and switches the input source through a single backend.
+// The backend is resolved on first use and reused afterwards. A Switcher is
+// safe for concurrent use.
+type Switcher struct {
+	backendName string
+	timeout     time.Duration
+	verify      bool
+	retries     int
+	errorLog    func(error)
+	listCache   bool
+
+	mu      sync.Mutex
+	backend Backend
+	sources []InputSource
+}
+
+// Option configures a Switcher.
+type Option func(*Switcher)
+
+// WithBackend selects a backend by name instead of detecting one. An empty
+// name falls back to IM_SWITCH_BACKEND and then to detection.
+func WithBackend(name string) Option {
+	return func(s *Switcher) {
+		s.backendName = name
+	}
+}
+
+// WithTimeout bounds each operation, including backend detection. A zero
+// timeout leaves the caller's context as the only limit.
+func WithTimeout(timeout time.Duration) Option {
+	return func(s *Switcher) {
+		s.timeout = timeout
+	}
+}
+
+// WithVerify makes Set read the input source back after switching. If the
+// switch has not taken effect, Set waits, switches again and re-checks up to
+// retries times, doubling the wait each time, and then fails with
+// ErrMismatch.
+func WithVerify(retries int) Option {
+	return func(s *Switcher) {
+		s.verify = true
+		s.retries = max(retries, 0)
+	}
+}
+
+// WithErrorLog passes errors that Watch recovers from, such as a failed read
+// of the current source while the daemon restarts, to fn. Each error is
+// reported once until reading succeeds or a different error occurs.
+func WithErrorLog(fn func(error)) Option {
+	return func(s *Switcher) {
+		s.errorLog = fn
+	}
+}
+
+// WithListCache makes CurrentSource reuse the sources it last listed while
+// they include the active one, instead of listing them on every call. It
+// suits long-lived Switchers such as that of `im-switch serve`. List itself
+// always asks the backend.
+func WithListCache() Option {
+	return func(s *Switcher) {
+		s.listCache = true
+	}
+}
+
+// New returns a Switcher configured by opts.
+func New(opts ...Option) *Switcher {
+	s := &Switcher{timeout: DefaultTimeout}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+func (s *Switcher) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, s.timeout)
+}
+
+func (s *Switcher) resolve(ctx context.Context) (Backend, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.backend != nil {
+		return s.backend, nil
+	}
+	backend, err := resolveBackend(ctx, s.backendName)
+	if err != nil {
+		return nil, err
+	}
+	s.backend = backend
+	return backend, nil
+}
+
+// Backend returns the backend the Switcher operates on, resolving it if
+// needed.
+func (s *Switcher) Backend(ctx context.Context) (Backend, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	return s.resolve(ctx)
+}
+
+// Current returns the active input source ID.
+func (s *Switcher) Current(ctx context.Context) (string, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	backend, err := s.resolve(ctx)
+	if err != nil {
+		return "", err
+	}
+	return backend.Current(ctx)
+}
+
+// List returns the input sources available through the backend.
+func (s *Switcher) List(ctx context.Context) ([]InputSource, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	backend, err := s.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return backend.List(ctx)
+}
+
+// CurrentSource returns the active input source with the details the backend
+// lists for it. If the backend does not list the active source, only ID and
+// Backend are set.
+func (s *Switcher) CurrentSource(ctx context.Context) (InputSource, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	backend, err := s.resolve(ctx)
+	if err != nil {
+		return InputSource{}, err
+	}
+	current, err := backend.Current(ctx)
+	if err != nil {
+		return InputSource{}, err
+	}
+	sources, err := s.listWith(ctx, backend, current)
+	if err == nil {
+		if source, ok := findSource(sources, current); ok {
+			return source, nil
+		}
+	}
+	return InputSource{ID: current, Backend: backend.Name()}, nil
+}
+
+// listWith lists the sources of backend. With WithListCache it reuses the
+// previous list if that includes sourceID.
+func (s *Switcher) listWith(ctx context.Context, backend Backend, sourceID string) ([]InputSource, error) {
+	if !s.listCache {
+		return backend.List(ctx)
+	}
+	s.mu.Lock()
+	cached := s.sources
+	s.mu.Unlock()
+	if _, ok := findSource(cached, sourceID); ok {
+		return cached, nil
+	}
+
+	sources, err := backend.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.sources = sources
+	s.mu.Unlock()
+	return sources, nil
+}
+
+// Set switches to the given input source ID. With WithVerify it also checks
+// that the switch took effect.
+func (s *Switcher) Set(ctx context.Context, sourceID string) error {
+	if err := s.set(ctx, sourceID); err != nil {
+		return err
+	}
+	if !s.verify {
+		return nil
+	}
+	return s.verifySet(ctx, sourceID)
+}
+
+// SetFirst switches to the first of sourceIDs that the backend lists and
+// returns it, so that one list of IDs can serve machines with different
+// backends. It fails with ErrUnknownSource when none of them is listed.
+// Backends whose List is partial, see PartialLister, are offered each ID in
+// turn instead, and the first one that Set does not reject as unknown is
+// chosen; any other failure of Set is returned as is.
+func (s *Switcher) SetFirst(ctx context.Context, sourceIDs ...string) (string, error) {
+	backend, err := s.Backend(ctx)
+	if err != nil {
+		return "", err
+	}
+	none := &Error{
+		Kind:    ErrUnknownSource,
+		Backend: backend.Name(),
+		Detail:  fmt.Sprintf("none of %s is available", strings.Join(sourceIDs, ", ")),
+	}
+
+	if lister, ok := backend.(PartialLister); ok && lister.PartialList() {
+		for _, id := range sourceIDs {
+			if err := s.Set(ctx, id); !errors.Is(err, ErrUnknownSource) {
+				return id, err
+			}
+		}
+		return "", none
+	}
+
+	sources, err := s.List(ctx)
+	if err != nil {
+		return "", err
+	}
+	for _, id := range sourceIDs {
+		if _, ok := findSource(sources, id); ok {
+			return id, s.Set(ctx, id)
+		}
+	}
+	return "", none
+}
+
+func (s *Switcher) set(ctx context.Context, sourceID string) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	backend, err := s.resolve(ctx)
+	if err != nil {
+		return err
+	}
+	return backend.Set(ctx, sourceID)
+}
+
+// Explain reports how the Switcher's backend is chosen. When a backend was
+// requested explicitly, the report records the override instead of running
+// detection.
+func (s *Switcher) Explain(ctx context.Context) (DetectionReport, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	name := backendOverride(s.backendName)
+	if name == "" {
+		report, err := explain(ctx)
+		if err != nil {
+			return DetectionReport{}, commandFailure("", "", err)
+		}
+		return report, nil
+	}
+	if _, err := resolveBackend(ctx, name); err != nil {
+		return DetectionReport{}, err
+	}
+
+	report := DetectionReport{Override: name, Probes: []ProbeReport{}}
+	report.finish(name)
+	return report, nil
+}
@@ -0,0 +1,337 @@
+package imswitch
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSwitcherWithBackend(t *testing.T) {
+	withBackends(t)
+	t.Setenv(BackendEnvVar, "")
+
+	Register(stubBackend{name: "a", current: "a-us"}, 10)
+	Register(stubBackend{name: "b", current: "b-us", sources: []string{"b-us", "b-ko"}}, 20)
+
+	s := New(WithBackend("b"))
+	ctx := context.Background()
+
+	backend, err := s.Backend(ctx)
+	if err != nil || backend.Name() != "b" {
+		t.Fatalf("Backend() = %v, %v, want b", backend, err)
+	}
+	if current, err := s.Current(ctx); err != nil || current != "b-us" {
+		t.Errorf("Current() = %q, %v, want b-us", current, err)
+	}
+	if sources, err := s.List(ctx); err != nil || len(sources) != 2 {
+		t.Errorf("List() = %v, %v, want 2 sources", sources, err)
+	}
+	if source, err := s.CurrentSource(ctx); err != nil || source.Name != "Stub b-us" {
+		t.Errorf("CurrentSource() = %+v, %v, want the listed b-us source", source, err)
+	}
+	if err := s.Set(ctx, "b-ko"); err != nil {
+		t.Errorf("Set() returned error: %v", err)
+	}
+	if err := s.Set(ctx, "b-jp"); !errors.Is(err, ErrUnknownSource) {
+		t.Errorf("Set() should fail with ErrUnknownSource, got %v", err)
+	}
+}
+
+func TestSwitcherSetFirst(t *testing.T) {
+	withBackends(t)
+	t.Setenv(BackendEnvVar, "")
+
+	Register(stubBackend{name: "a", sources: []string{"keyboard-us", "hangul"}}, 10)
+	s := New(WithBackend("a"))
+	ctx := context.Background()
+
+	if id, err := s.SetFirst(ctx, "xkb:us::eng", "keyboard-us", "us"); err != nil || id != "keyboard-us" {
+		t.Errorf("SetFirst() = %q, %v, want keyboard-us", id, err)
+	}
+	if id, err := s.SetFirst(ctx, "hangul", "keyboard-us"); err != nil || id != "hangul" {
+		t.Errorf("SetFirst() = %q, %v, want the first listed ID", id, err)
+	}
+	_, err := s.SetFirst(ctx, "xkb:us::eng", "us")
+	if !errors.Is(err, ErrUnknownSource) || err.Error() != "a: unknown input source: none of xkb:us::eng, us is available" {
+		t.Errorf("SetFirst() with no listed ID = %v", err)
+	}
+}
+
+// partialBackend lists only us but, like setxkbmap, switches to any layout
+// name without a colon.
+type partialBackend struct {
+	stubBackend
+	current *string
+}
+
+func (b partialBackend) PartialList() bool { return true }
+
+func (b partialBackend) Set(ctx context.Context, sourceID string) error {
+	if strings.Contains(sourceID, ":") {
+		return &Error{Kind: ErrUnknownSource, Backend: b.name, Source: sourceID}
+	}
+	if sourceID == "broken" {
+		return &Error{Kind: ErrCommandFailed, Backend: b.name, Source: sourceID, Detail: "cannot open display"}
+	}
+	*b.current = sourceID
+	return nil
+}
+
+func TestSwitcherSetFirstPartialList(t *testing.T) {
+	withBackends(t)
+	t.Setenv(BackendEnvVar, "")
+
+	var current string
+	Register(partialBackend{stubBackend{name: "a", sources: []string{"us"}}, &current}, 10)
+	s := New(WithBackend("a"))
+
+	if id, err := s.SetFirst(context.Background(), "xkb:us::eng", "us(intl)", "us"); err != nil || id != "us(intl)" || current != "us(intl)" {
+		t.Errorf("SetFirst() = %q, %v, want the unlisted us(intl)", id, err)
+	}
+	if _, err := s.SetFirst(context.Background(), "xkb:us::eng", "keyboard:us"); !errors.Is(err, ErrUnknownSource) {
+		t.Errorf("SetFirst() with no accepted ID = %v, want ErrUnknownSource", err)
+	}
+	if _, err := s.SetFirst(context.Background(), "xkb:us::eng", "broken", "us"); !errors.Is(err, ErrCommandFailed) {
+		t.Errorf("SetFirst() with a failing backend = %v, want ErrCommandFailed", err)
+	}
+}
+
+func TestSwitcherUnknownBackend(t *testing.T) {
+	withBackends(t)
+	t.Setenv(BackendEnvVar, "")
+
+	Register(stubBackend{name: "a"}, 10)
+
+	if _, err := New(WithBackend("missing")).Current(context.Background()); !errors.Is(err, ErrBackendUnavailable) {
+		t.Errorf("Current() should fail with ErrBackendUnavailable, got %v", err)
+	}
+}
+
+func TestSwitcherCachesBackend(t *testing.T) {
+	withBackends(t)
+	t.Setenv(BackendEnvVar, "")
+
+	Register(stubBackend{name: "a", current: "first"}, 10)
+	s := New(WithBackend("a"))
+	if _, err := s.Backend(context.Background()); err != nil {
+		t.Fatalf("Backend() returned error: %v", err)
+	}
+
+	Register(stubBackend{name: "a", current: "second"}, 10)
+	if current, _ := s.Current(context.Background()); current != "first" {
+		t.Errorf("Switcher should keep the backend it resolved first, got %q", current)
+	}
+}
+
+// countingBackend counts its List calls. Its current source and sources can
+// be changed after it is registered.
+type countingBackend struct {
+	stubBackend
+	current *string
+	sources *[]string
+	lists   *int
+}
+
+func (b countingBackend) Current(ctx context.Context) (string, error) {
+	return *b.current, nil
+}
+
+func (b countingBackend) List(ctx context.Context) ([]InputSource, error) {
+	*b.lists++
+	b.stubBackend.sources = *b.sources
+	return b.stubBackend.List(ctx)
+}
+
+func TestSwitcherListCache(t *testing.T) {
+	withBackends(t)
+	t.Setenv(BackendEnvVar, "")
+
+	current, sources, lists := "", []string{"a-us", "a-ko"}, 0
+	Register(countingBackend{stubBackend{name: "a"}, &current, &sources, &lists}, 10)
+	s := New(WithBackend("a"), WithListCache())
+	ctx := context.Background()
+
+	for _, id := range []string{"a-us", "a-ko", "a-us"} {
+		current = id
+		if source, err := s.CurrentSource(ctx); err != nil || source.Name != "Stub "+id {
+			t.Errorf("CurrentSource() = %+v, %v, want the listed %s", source, err, id)
+		}
+	}
+	if lists != 1 {
+		t.Errorf("CurrentSource() listed the sources %d times, want once", lists)
+	}
+
+	// A source missing from the cached list makes it read again.
+	current, sources = "a-jp", append(sources, "a-jp")
+	if source, err := s.CurrentSource(ctx); err != nil || source.Name != "Stub a-jp" || lists != 2 {
+		t.Errorf("CurrentSource() = %+v, %v after %d lists, want a-jp listed anew", source, err, lists)
+	}
+}
+
+func TestSwitcherTimeout(t *testing.T) {
+	withBackends(t)
+	t.Setenv(BackendEnvVar, "")
+
+	Register(stubBackend{name: "slow", hang: true}, 10)
+	s := New(WithBackend("slow"), WithTimeout(10*time.Millisecond))
+
+	if _, err := s.Current(context.Background()); !errors.Is(err, ErrTimeout) {
+		t.Errorf("Current() should fail with ErrTimeout, got %v", err)
+	}
+}
+
+func TestSwitcherExplainOverride(t *testing.T) {
+	withBackends(t)
+	t.Setenv(BackendEnvVar, "")
+
+	Register(stubBackend{name: "a"}, 10)
+	Register(stubBackend{name: "b"}, 20)
+
+	report, err := New(WithBackend("b")).Explain(context.Background())
+	if err != nil {
+		t.Fatalf("Explain() returned error: %v", err)
+	}
+	if report.Override != "b" || report.Selected != "b" {
+		t.Errorf("Explain() = %+v, want override and selection b", report)
+	}
+	if len(report.Rejected) != 1 || report.Rejected[0].Backend != "a" {
+		t.Errorf("Explain() rejected = %v, want [a]", report.Rejected)
+	}
+}
+
+// requireLiveBackend skips tests that need a running input method framework,
+// such as on headless CI machines.
+func requireLiveBackend(t *testing.T) {
+	t.Helper()
+	if backend, err := activeBackend(context.Background()); err != nil || backend == nil {
+		t.Skip("No input method framework detected, skipping live test")
+	}
+}
+
+func TestGetCurrentInputSource(t *testing.T) {
+	requireLiveBackend(t)
+	current, err := New().Current(context.Background())
+	if err != nil {
+		t.Errorf("Current() returned error: %v", err)
+	}
+	if current == "" {
+		t.Error("Current() returned empty string")
+	}
+}
+
+func TestGetAllInputSources(t *testing.T) {
+	requireLiveBackend(t)
+	sources, err := New().List(context.Background())
+	if err != nil {
+		t.Errorf("List() returned error: %v", err)
+		return
+	}
+	if len(sources) == 0 {
+		t.Error("List() returned empty slice")
+	}
+}
+
+func TestSetInputSourceWithInvalidID(t *testing.T) {
+	invalidID := "invalid-input-source-id-that-should-not-exist"
+	if err := New().Set(context.Background(), invalidID); err == nil {
+		t.Error("Set() should return an error for invalid input source")
+	}
+}
+
+func TestSetInputSourceWithCurrentID(t *testing.T) {
+	current, err := New().Current(context.Background())
+	if err != nil {
+		t.Skip("Cannot get current input source, skipping test")
+	}
+
+	if err := New().Set(context.Background(), current); err != nil {
+		t.Errorf("Set() should succeed when setting to current input source: %v", err)
+	}
+}
+
+func TestPlatformSpecificFunctions(t *testing.T) {
+	requireLiveBackend(t)
+	if runtime.GOOS == "darwin" {
+		testDarwinFunctions(t)
+	} else if runtime.GOOS == "linux" {
+		testLinuxFunctions(t)
+	} else {
+		t.Skip("Unsupported platform")
+	}
+}
+
+func testDarwinFunctions(t *testing.T) {
+	current, err := New().Current(context.Background())
+	if err != nil {
+		t.Errorf("macOS Current() returned error: %v", err)
+	}
+
+	sources, _ := New().List(context.Background())
+	if len(sources) == 0 {
+		t.Error("macOS List() returned no sources")
+	}
+
+	found := false
+	for _, source := range sources {
+		if source.ID == current {
+			found = true
+			break
+		}
+	}
+	if !found {
+		t.Error("Current input source not found in available sources list")
+	}
+}
+
+func testLinuxFunctions(t *testing.T) {
+	current, err := New().Current(context.Background())
+	if err != nil || current == "" {
+		t.Errorf("Linux Current() returned %q, %v", current, err)
+	}
+
+	sources, _ := New().List(context.Background())
+	if len(sources) == 0 {
+		t.Error("Linux List() returned no sources")
+	}
+}
+
+func TestInputSourceToggling(t *testing.T) {
+	originalSource, err := New().Current(context.Background())
+	if err != nil {
+		t.Skip("Cannot get current input source, skipping toggle test")
+	}
+
+	sources, _ := New().List(context.Background())
+	if len(sources) < 2 {
+		t.Skip("Need at least 2 input sources for toggle test")
+	}
+
+	var alternativeSource string
+	for _, source := range sources {
+		if source.ID != originalSource {
+			alternativeSource = source.ID
+			break
+		}
+	}
+
+	if alternativeSource == "" {
+		t.Skip("Could not find alternative input source")
+	}
+
+	if err := New().Set(context.Background(), alternativeSource); err != nil {
+		t.Errorf("Failed to switch to alternative input source: %v", err)
+		return
+	}
+
+	current, _ := New().Current(context.Background())
+	if current != alternativeSource {
+		t.Errorf("Expected input source %s, got %s", alternativeSource, current)
+	}
+
+	if err := New().Set(context.Background(), originalSource); err != nil {
+		t.Errorf("Failed to restore original input source: %v", err)
+	}
+}
@@ -0,0 +1,152 @@
+package imswitch
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// DefaultVerifyRetries is how often a verified Set switches again before
+// giving up, for callers that have no better number.
+const DefaultVerifyRetries = 3
+
+// verifyBackoff is the wait before the first retry of a verified Set.
+var verifyBackoff = 20 * time.Millisecond
+
+// Verifier is implemented by backends whose Current does not show the effect
+// of Set. The Windows backend, for one, opens or closes the IME but leaves
+// the keyboard layout alone.
+type Verifier interface {
+	// Verify reports whether sourceID is in effect, along with a
+	// description of what is active for error messages.
+	Verify(ctx context.Context, sourceID string) (actual string, ok bool, err error)
+}
+
+// Toggler is implemented by backends whose Set flips a state rather than
+// setting it. The Windows backend, for one, presses the IME toggle key, and
+// a second press sent before the first takes effect undoes it.
+type Toggler interface {
+	// Toggles reports whether Set toggles.
+	Toggles() bool
+}
+
+// verifySet checks that sourceID took effect after a Set, switching again
+// with a growing backoff until it does or the retries run out. Backends that
+// toggle are only checked again during the backoff, and switched once more
+// if they still report the old state after all of it.
+func (s *Switcher) verifySet(ctx context.Context, sourceID string) error {
+	backend, err := s.Backend(ctx)
+	if err != nil {
+		return err
+	}
+	toggler, ok := backend.(Toggler)
+	toggles := ok && toggler.Toggles()
+
+	backoff := verifyBackoff
+	resent := false
+	for attempt := 0; ; attempt++ {
+		actual, ok, err := s.check(ctx, sourceID)
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+		if attempt >= s.retries && (!toggles || resent || s.retries == 0) {
+			return &Error{
+				Kind:    ErrMismatch,
+				Backend: backend.Name(),
+				Source:  sourceID,
+				Detail:  fmt.Sprintf("expected %s, got %s after %d attempts", sourceID, actual, attempt+1),
+			}
+		}
+
+		if toggles && attempt == s.retries {
+			if err := s.set(ctx, sourceID); err != nil {
+				return err
+			}
+			resent = true
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return commandFailure(backend.Name(), sourceID, ctx.Err())
+		}
+		backoff *= 2
+		if !toggles {
+			if err := s.set(ctx, sourceID); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// WaitFor blocks until sourceID is in effect or ctx is done, judging by the
+// backend's Verifier when it has one, like WithVerify, and by Current
+// otherwise. It returns what was last seen active, and ctx.Err() when ctx is
+// done first. Backends without a Verifier are followed as Watch follows them;
+// the others are checked every interval, and failed checks are retried.
+func (s *Switcher) WaitFor(ctx context.Context, sourceID string, interval time.Duration) (string, error) {
+	backend, err := s.Backend(ctx)
+	if err != nil {
+		return "", err
+	}
+	if _, ok := backend.(Verifier); !ok {
+		last := ""
+		err := s.Watch(ctx, interval, func(source InputSource) bool {
+			last = source.ID
+			return source.ID != sourceID
+		})
+		return last, err
+	}
+
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	last := ""
+	for {
+		actual, ok, err := s.check(ctx, sourceID)
+		switch {
+		case err == nil && ok:
+			return actual, nil
+		case err == nil:
+			last = actual
+		case ctx.Err() != nil:
+			return last, ctx.Err()
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return last, ctx.Err()
+		}
+	}
+}
+
+// Active reports whether sourceID is in effect, judging by the backend's
+// Verifier when it has one, like WithVerify, and by Current otherwise.
+func (s *Switcher) Active(ctx context.Context, sourceID string) (bool, error) {
+	_, ok, err := s.check(ctx, sourceID)
+	return ok, err
+}
+
+// check reports what is active and whether it is sourceID.
+func (s *Switcher) check(ctx context.Context, sourceID string) (string, bool, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	backend, err := s.resolve(ctx)
+	if err != nil {
+		return "", false, err
+	}
+	if verifier, ok := backend.(Verifier); ok {
+		return verifier.Verify(ctx, sourceID)
+	}
+	current, err := backend.Current(ctx)
+	if err != nil {
+		return "", false, err
+	}
+	return current, current == sourceID, nil
+}
@@ -0,0 +1,210 @@
+package imswitch
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// lazyBackend only takes a switch on the applyOn-th Set call, like a daemon
+// that drops requests; applyOn 0 never takes it.
+type lazyBackend struct {
+	stubBackend
+	applyOn int
+
+	mu      sync.Mutex
+	sets    int
+	current string
+}
+
+func (b *lazyBackend) Current(ctx context.Context) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.current, nil
+}
+
+func (b *lazyBackend) Set(ctx context.Context, sourceID string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.sets++
+	if b.sets == b.applyOn {
+		b.current = sourceID
+	}
+	return nil
+}
+
+// verifyingBackend reports its state through Verify only.
+type verifyingBackend struct {
+	*lazyBackend
+}
+
+func (b verifyingBackend) Current(ctx context.Context) (string, error) {
+	return "layout", nil
+}
+
+func (b verifyingBackend) Verify(ctx context.Context, sourceID string) (string, bool, error) {
+	current, _ := b.lazyBackend.Current(ctx)
+	return current, current == sourceID, nil
+}
+
+func TestSwitcherVerify(t *testing.T) {
+	saved := verifyBackoff
+	verifyBackoff = time.Millisecond
+	t.Cleanup(func() { verifyBackoff = saved })
+
+	testCases := []struct {
+		name     string
+		applyOn  int
+		retries  int
+		verifier bool
+		sets     int
+		err      error
+	}{
+		{"first try", 1, 3, false, 1, nil},
+		{"after retries", 3, 3, false, 3, nil},
+		{"out of retries", 0, 2, false, 3, ErrMismatch},
+		{"no retries", 2, 0, false, 1, ErrMismatch},
+		{"verifier", 2, 3, true, 2, nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			withBackends(t)
+			t.Setenv(BackendEnvVar, "")
+
+			lazy := &lazyBackend{stubBackend: stubBackend{name: "lazy"}, applyOn: tc.applyOn, current: "us"}
+			var backend Backend = lazy
+			if tc.verifier {
+				backend = verifyingBackend{lazy}
+			}
+			Register(backend, 10)
+
+			err := New(WithBackend("lazy"), WithVerify(tc.retries)).Set(context.Background(), "ko")
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("Set() = %v, want %v", err, tc.err)
+			}
+			if lazy.sets != tc.sets {
+				t.Errorf("backend Set called %d times, want %d", lazy.sets, tc.sets)
+			}
+			if tc.err != nil && !strings.Contains(err.Error(), "expected ko, got us") {
+				t.Errorf("Set() error %q should name the expected and actual sources", err)
+			}
+		})
+	}
+}
+
+// toggleBackend flips between us and ko on every Set, like the IME toggle
+// key on Windows. A flip only shows after latency, and with drop set the
+// first one is lost.
+type toggleBackend struct {
+	stubBackend
+	latency time.Duration
+	drop    bool
+
+	mu      sync.Mutex
+	toggles []time.Time
+	sets    int
+}
+
+func (b *toggleBackend) Toggles() bool { return true }
+
+func (b *toggleBackend) Current(ctx context.Context) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	landed := 0
+	for _, at := range b.toggles {
+		if time.Since(at) >= b.latency {
+			landed++
+		}
+	}
+	if landed%2 == 1 {
+		return "ko", nil
+	}
+	return "us", nil
+}
+
+func (b *toggleBackend) Set(ctx context.Context, sourceID string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.sets++
+	if !b.drop || b.sets > 1 {
+		b.toggles = append(b.toggles, time.Now())
+	}
+	return nil
+}
+
+func TestSwitcherVerifyToggle(t *testing.T) {
+	saved := verifyBackoff
+	verifyBackoff = time.Millisecond
+	t.Cleanup(func() { verifyBackoff = saved })
+
+	testCases := []struct {
+		name    string
+		latency time.Duration
+		drop    bool
+		sets    int
+		err     error
+	}{
+		// Checks at 0, 1, 3 and 7ms see the flip before the backoff ends.
+		{"slow toggle", 5 * time.Millisecond, false, 1, nil},
+		{"lost toggle", 0, true, 2, nil},
+		{"never lands", time.Hour, false, 2, ErrMismatch},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			withBackends(t)
+			t.Setenv(BackendEnvVar, "")
+
+			b := &toggleBackend{stubBackend: stubBackend{name: "toggle"}, latency: tc.latency, drop: tc.drop}
+			Register(b, 10)
+
+			err := New(WithBackend("toggle"), WithVerify(3)).Set(context.Background(), "ko")
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("Set() = %v, want %v", err, tc.err)
+			}
+			if b.sets != tc.sets {
+				t.Errorf("backend Set called %d times, want %d", b.sets, tc.sets)
+			}
+		})
+	}
+}
+
+func TestSwitcherWithoutVerify(t *testing.T) {
+	withBackends(t)
+	t.Setenv(BackendEnvVar, "")
+
+	lazy := &lazyBackend{stubBackend: stubBackend{name: "lazy"}, current: "us"}
+	Register(lazy, 10)
+
+	if err := New(WithBackend("lazy")).Set(context.Background(), "ko"); err != nil {
+		t.Fatalf("Set() returned error: %v", err)
+	}
+	if lazy.sets != 1 {
+		t.Errorf("backend Set called %d times, want 1", lazy.sets)
+	}
+}
+
+func TestSwitcherWaitForUsesVerifier(t *testing.T) {
+	withBackends(t)
+	t.Setenv(BackendEnvVar, "")
+
+	// Current never changes, so only Verify can tell that kr took effect.
+	lazy := &lazyBackend{stubBackend: stubBackend{name: "lazy"}, applyOn: 1, current: "us"}
+	Register(verifyingBackend{lazy}, 10)
+	s := New(WithBackend("lazy"))
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		s.Set(context.Background(), "kr")
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if actual, err := s.WaitFor(ctx, "kr", time.Millisecond); err != nil || actual != "kr" {
+		t.Errorf("WaitFor() = %q, %v, want kr", actual, err)
+	}
+}
@@ -0,0 +1,101 @@
+package imswitch
+
+import (
+	"context"
+	"time"
+)
+
+// DefaultPollInterval is how often Watch reads the current source of a
+// backend that does not report changes itself.
+const DefaultPollInterval = 250 * time.Millisecond
+
+// EventSource is implemented by backends that can report input source
+// changes as they happen, so that Watch does not have to poll them.
+type EventSource interface {
+	// Events returns a channel that receives a value whenever the input
+	// source may have changed. The channel is closed when the backend stops
+	// reporting changes or ctx is done. An error means events are not
+	// available and the caller should poll instead.
+	Events(ctx context.Context) (<-chan struct{}, error)
+}
+
+// Watch calls fn with the current input source, then again every time it
+// changes, until fn returns false or ctx is done. Backends that implement
+// EventSource are followed through their events; others, and those whose
+// events stop, are polled every interval. When reading the source fails,
+// Watch reports the error to the WithErrorLog function and tries again after
+// interval. It returns nil when fn stops it and ctx.Err() when ctx is done.
+func (s *Switcher) Watch(ctx context.Context, interval time.Duration, fn func(InputSource) bool) error {
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	backend, err := s.Backend(ctx)
+	if err != nil {
+		return err
+	}
+
+	var events <-chan struct{}
+	if source, ok := backend.(EventSource); ok {
+		if ch, err := source.Events(ctx); err == nil {
+			events = ch
+		}
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var sources []InputSource
+	last := ""
+	var lastErr error
+	for {
+		id, err := s.Current(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if s.errorLog != nil && (lastErr == nil || err.Error() != lastErr.Error()) {
+				s.errorLog(err)
+			}
+			lastErr = err
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			continue
+		}
+		lastErr = nil
+		if id != last {
+			last = id
+			source, ok := findSource(sources, id)
+			if !ok {
+				// Sources may have been added since the last listing.
+				if listed, err := s.List(ctx); err == nil {
+					sources = listed
+				}
+				if source, ok = findSource(sources, id); !ok {
+					source = InputSource{ID: id, Backend: backend.Name()}
+				}
+			}
+			if !fn(source) {
+				return nil
+			}
+		}
+
+		if events != nil {
+			select {
+			case _, ok := <-events:
+				if !ok {
+					events = nil
+				}
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			continue
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
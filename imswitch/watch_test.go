@@ -0,0 +1,171 @@
+package imswitch
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// sequenceBackend reports the scripted sources in turn, one per Current
+// call, and keeps reporting the last one. An empty entry is a failed read.
+// With events set it also implements EventSource.
+type sequenceBackend struct {
+	stubBackend
+	mu       sync.Mutex
+	currents []string
+	events   chan struct{}
+}
+
+func (b *sequenceBackend) Current(ctx context.Context) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	current := b.currents[0]
+	if len(b.currents) > 1 {
+		b.currents = b.currents[1:]
+	}
+	if current == "" {
+		return "", &Error{Kind: ErrCommandFailed, Backend: b.name, Detail: "daemon is restarting"}
+	}
+	return current, nil
+}
+
+type eventBackend struct {
+	*sequenceBackend
+}
+
+func (b eventBackend) Events(ctx context.Context) (<-chan struct{}, error) {
+	return b.events, nil
+}
+
+func collectWatch(t *testing.T, s *Switcher, interval time.Duration, n int) ([]string, error) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var seen []string
+	err := s.Watch(ctx, interval, func(source InputSource) bool {
+		seen = append(seen, source.ID)
+		return len(seen) < n
+	})
+	return seen, err
+}
+
+func TestSwitcherWatchPolls(t *testing.T) {
+	withBackends(t)
+	t.Setenv(BackendEnvVar, "")
+
+	b := &sequenceBackend{
+		stubBackend: stubBackend{name: "seq", sources: []string{"us", "kr"}},
+		currents:    []string{"us", "us", "kr", "kr", "us"},
+	}
+	Register(b, 10)
+
+	var sources []InputSource
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := New(WithBackend("seq")).Watch(ctx, time.Millisecond, func(source InputSource) bool {
+		sources = append(sources, source)
+		return len(sources) < 3
+	})
+	if err != nil {
+		t.Fatalf("Watch() returned error: %v", err)
+	}
+
+	var ids []string
+	for _, source := range sources {
+		ids = append(ids, source.ID)
+	}
+	if want := []string{"us", "kr", "us"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("Watch() reported %v, want %v", ids, want)
+	}
+	if sources[1].Name != "Stub kr" {
+		t.Errorf("Watch() should report listed details, got %+v", sources[1])
+	}
+}
+
+func TestSwitcherWatchEvents(t *testing.T) {
+	withBackends(t)
+	t.Setenv(BackendEnvVar, "")
+
+	events := make(chan struct{}, 1)
+	b := eventBackend{&sequenceBackend{
+		stubBackend: stubBackend{name: "events"},
+		currents:    []string{"us", "kr"},
+		events:      events,
+	}}
+	Register(b, 10)
+
+	events <- struct{}{}
+	// A poll interval this long means only the event can report "kr" in time.
+	seen, err := collectWatch(t, New(WithBackend("events")), time.Hour, 2)
+	if err != nil {
+		t.Fatalf("Watch() returned error: %v", err)
+	}
+	if want := []string{"us", "kr"}; !reflect.DeepEqual(seen, want) {
+		t.Errorf("Watch() reported %v, want %v", seen, want)
+	}
+}
+
+func TestSwitcherWatchFallsBackToPolling(t *testing.T) {
+	withBackends(t)
+	t.Setenv(BackendEnvVar, "")
+
+	events := make(chan struct{})
+	close(events)
+	b := eventBackend{&sequenceBackend{
+		stubBackend: stubBackend{name: "events"},
+		currents:    []string{"us", "kr"},
+		events:      events,
+	}}
+	Register(b, 10)
+
+	seen, err := collectWatch(t, New(WithBackend("events")), time.Millisecond, 2)
+	if err != nil {
+		t.Fatalf("Watch() returned error: %v", err)
+	}
+	if want := []string{"us", "kr"}; !reflect.DeepEqual(seen, want) {
+		t.Errorf("Watch() reported %v, want %v", seen, want)
+	}
+}
+
+func TestSwitcherWatchSurvivesFailedReads(t *testing.T) {
+	withBackends(t)
+	t.Setenv(BackendEnvVar, "")
+
+	b := &sequenceBackend{
+		stubBackend: stubBackend{name: "seq"},
+		currents:    []string{"us", "", "", "kr"},
+	}
+	Register(b, 10)
+
+	var logged []error
+	seen, err := collectWatch(t, New(WithBackend("seq"), WithErrorLog(func(err error) {
+		logged = append(logged, err)
+	})), time.Millisecond, 2)
+	if err != nil {
+		t.Fatalf("Watch() returned error: %v", err)
+	}
+	if want := []string{"us", "kr"}; !reflect.DeepEqual(seen, want) {
+		t.Errorf("Watch() reported %v, want %v", seen, want)
+	}
+	if len(logged) != 1 || !errors.Is(logged[0], ErrCommandFailed) {
+		t.Errorf("Watch() logged %v, want the repeated failure once", logged)
+	}
+}
+
+func TestSwitcherWatchContextDone(t *testing.T) {
+	withBackends(t)
+	t.Setenv(BackendEnvVar, "")
+
+	Register(stubBackend{name: "a", current: "us"}, 10)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := New(WithBackend("a")).Watch(ctx, time.Millisecond, func(InputSource) bool { return true })
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Watch() = %v, want context.DeadlineExceeded", err)
+	}
+}
@@ -12,14 +12,19 @@ local function get_default_config()
 			default_input = "com.apple.keylayout.ABC",
 			auto_switch = true,
 			auto_restore = false,
+			server = false,
+			server_timeout = 1000,
 			debug = false,
 		}
 	elseif is_linux then
 		return {
 			binary_path = "im-switch",
-			default_input = "us",
+			-- IBus, Fcitx and plain XKB name US English differently
+			default_input = { "xkb:us::eng", "keyboard-us", "us" },
 			auto_switch = true,
 			auto_restore = false,
+			server = false,
+			server_timeout = 1000,
 			debug = false,
 		}
 	else
@@ -28,6 +33,8 @@ local function get_default_config()
 			default_input = "en-US",
 			auto_switch = true,
 			auto_restore = false,
+			server = false,
+			server_timeout = 1000,
 			debug = false,
 		}
 	end
@@ -42,6 +49,8 @@ local saved_input = nil
 local last_mode = nil
 ---@type boolean
 local enabled = true
+---@type integer Interface level of the binary, 0 if unknown
+local binary_api = 0
 
 ---@param msg string
 local function log(msg)
@@ -75,8 +84,126 @@ local function execute_command(args)
 	return result:gsub("%s+$", "")
 end
 
+---@param args string[] Arguments that may contain shell metacharacters, e.g. "us(intl)"
+---@return string args The arguments quoted for execute_command
+local function shell_args(args)
+	local quoted = {}
+	for _, arg in ipairs(args) do
+		table.insert(quoted, vim.fn.shellescape(arg))
+	end
+	return table.concat(quoted, " ")
+end
+
+-- Oldest binary interface level, as reported by `im-switch version --json`,
+-- that provides every command this plugin uses
+local required_api = 1
+-- Interface level that added `im-switch serve --stdio`
+local serve_api = 2
+-- Interface level that lets `im-switch set` take several IDs
+local set_first_api = 3
+
+local function check_binary_version()
+	local output = execute_command("version --json")
+	local ok, info = pcall(function()
+		return vim.json.decode(output or "")
+	end)
+	binary_api = ok and type(info) == "table" and tonumber(info.api) or 0
+	if binary_api < required_api then
+		vim.notify(
+			"[im-switch] " .. config.binary_path .. " is older than this plugin expects, rebuild it with 'make build'",
+			vim.log.levels.WARN
+		)
+		return
+	end
+	log("Binary version: " .. tostring(info.version))
+end
+
+---@type integer|nil Job ID of the `im-switch serve --stdio` process
+local server_job = nil
+---@type string[] Complete response lines not yet consumed
+local server_lines = {}
+---@type string Start of a response line still being received
+local server_partial = ""
+
+local function stop_server()
+	if server_job then
+		vim.fn.jobstop(server_job)
+		server_job = nil
+	end
+end
+
+---@return boolean started True if the server is running
+local function start_server()
+	if server_job then
+		return true
+	end
+	server_lines = {}
+	server_partial = ""
+	local job
+	job = vim.fn.jobstart({ config.binary_path, "serve", "--stdio" }, {
+		on_stdout = function(_, data)
+			-- A server that was stopped may still deliver output, which must
+			-- not be taken for the current server's responses
+			if job ~= server_job then
+				return
+			end
+			-- data[1] continues the previous partial line, and the last
+			-- element starts the next one
+			server_partial = server_partial .. data[1]
+			for i = 2, #data do
+				table.insert(server_lines, server_partial)
+				server_partial = data[i]
+			end
+		end,
+		on_exit = function()
+			if job == server_job then
+				server_job = nil
+			end
+		end,
+	})
+	if job <= 0 then
+		log("Failed to start: " .. config.binary_path .. " serve --stdio")
+		return false
+	end
+	server_job = job
+	return true
+end
+
+---Send one request to the server and wait for its response
+---@param args string[] Command and arguments, e.g. { "set", "hangul" }
+---@return table|nil response Decoded response, or nil if the server is not usable
+local function server_request(args)
+	if not config.server or binary_api < serve_api or not start_server() then
+		return nil
+	end
+	local request = vim.json.encode(args)
+	vim.fn.chansend(server_job, request .. "\n")
+	local answered = vim.wait(config.server_timeout, function()
+		return #server_lines > 0
+	end, 1)
+	if not answered then
+		-- A late answer would be taken for the next request's, so start over
+		log("No response to: " .. request)
+		stop_server()
+		return nil
+	end
+	local ok, response = pcall(vim.json.decode, table.remove(server_lines, 1))
+	if not ok or type(response) ~= "table" then
+		stop_server()
+		return nil
+	end
+	if not response.ok and response.error then
+		log("Request failed: " .. request .. ": " .. tostring(response.error.message))
+	end
+	return response
+end
+
 ---@return string|nil current_input Current input method ID or nil if failed
 local function get_current_input()
+	local response = server_request({ "get" })
+	if response then
+		return response.ok and response.result and response.result.id or nil
+	end
 	return execute_command()
 end
 
@@ -84,20 +211,91 @@ end
 ---@return boolean success True if successful, false otherwise
 local function set_input(input_id)
 	if input_id and input_id ~= "" then
-		local result = execute_command(input_id)
+		local response = server_request({ "set", input_id })
+		local success
+		if response then
+			success = response.ok
+		else
+			success = execute_command(shell_args({ input_id })) ~= nil
+		end
 		log("Switched to: " .. input_id)
-		return result ~= nil
+		return success
 	end
 	return false
 end
 
+---@type string|nil The entry of a default_input list that the backend has
+local chosen_default = nil
+
+---@return string[] inputs default_input as a list of candidate IDs
+local function default_inputs()
+	if chosen_default then
+		return { chosen_default }
+	end
+	if type(config.default_input) == "table" then
+		return config.default_input
+	end
+	return { config.default_input }
+end
+
+---@param input_id string
+---@return boolean is_default True if input_id is one of the default inputs
+local function is_default(input_id)
+	for _, default_input in ipairs(default_inputs()) do
+		if default_input == input_id then
+			return true
+		end
+	end
+	return false
+end
+
+---Switch to the default input, finding out on first use which of several
+---candidate IDs the backend has
+---@return boolean success True if successful, false otherwise
+local function set_default_input()
+	local inputs = default_inputs()
+	if #inputs == 1 then
+		return set_input(inputs[1])
+	end
+
+	local chosen
+	if binary_api >= set_first_api then
+		local response = server_request({ "set", unpack(inputs) })
+		if response then
+			chosen = response.ok and response.result and response.result.selected or nil
+		else
+			-- The exit status is lost under LuaJIT and errors are merged into
+			-- the output, so only trust a decoded result
+			local output = execute_command("--json set " .. shell_args(inputs))
+			local ok, result = pcall(vim.json.decode, output or "")
+			chosen = ok and type(result) == "table" and result.selected or nil
+		end
+	else
+		-- Older binaries take a single ID, so try each in turn
+		for _, input_id in ipairs(inputs) do
+			if set_input(input_id) then
+				chosen = input_id
+				break
+			end
+		end
+	end
+
+	if type(chosen) ~= "string" or chosen == "" then
+		log("None of the default inputs is available: " .. table.concat(inputs, ", "))
+		return false
+	end
+	log("Using default input: " .. chosen)
+	chosen_default = chosen
+	return true
+end
+
 local function switch_to_default()
 	if enabled and config.auto_switch then
 		local current = get_current_input()
-		if current and current ~= config.default_input then
+		if current and not is_default(current) then
 			saved_input = current
 			log("Saving current input: " .. current)
-			set_input(config.default_input)
+			set_default_input()
 		end
 	end
 end
@@ -140,7 +338,7 @@ local function on_focus_lost()
 	end
 
 	local current = get_current_input()
-	if current and current ~= config.default_input then
+	if current and not is_default(current) then
 		saved_input = current
 	end
 end
@@ -167,6 +365,11 @@ local function setup_autocmds()
 		group = group,
 		callback = switch_to_default,
 	})
+
+	vim.api.nvim_create_autocmd({ "VimLeavePre" }, {
+		group = group,
+		callback = stop_server,
+	})
 end
 
 ---Initialize the im-switch plugin
@@ -174,6 +377,11 @@ end
 function M.setup(opts)
 	opts = opts or {}
 	config = vim.tbl_deep_extend("force", config, opts)
+	-- A list replaces the default list rather than merging with it
+	if opts.default_input then
+		config.default_input = opts.default_input
+	end
+	chosen_default = nil
 
 	if not opts or not opts.binary_path then
 		local plugin_dir = vim.fn.fnamemodify(debug.getinfo(1, "S").source:sub(2), ":p:h:h:h")
@@ -194,6 +402,8 @@ function M.setup(opts)
 		return
 	end
 
+	check_binary_version()
+
 	local current = get_current_input()
 	if not current or current == "" then
 		vim.notify("[im-switch] Failed to get current input method", vim.log.levels.WARN)
@@ -201,7 +411,7 @@ function M.setup(opts)
 	end
 
 	log("Current input method: " .. current)
-	log("Default input method: " .. config.default_input)
+	log("Default input method: " .. table.concat(default_inputs(), ", "))
 
 	setup_autocmds()
 
@@ -233,7 +443,17 @@ function M.setup(opts)
 	vim.api.nvim_create_user_command("ImSwitchStatus", function()
 		local status = enabled and "Enabled" or "Disabled"
 		local current = get_current_input()
-		local msg = string.format("[im-switch] Status: %s | Current input: %s", status, current or "Unknown")
+		local backend = "Unknown"
+		local ok, detection = pcall(vim.json.decode, execute_command("detect --json") or "")
+		if ok and type(detection) == "table" and detection.selected and detection.selected ~= "" then
+			backend = detection.selected
+		end
+		local msg = string.format(
+			"[im-switch] Status: %s | Backend: %s | Current input: %s",
+			status,
+			backend,
+			current or "Unknown"
+		)
 		vim.notify(msg, vim.log.levels.INFO)
 	end, { desc = "Show im-switch plugin status" })
 
@@ -261,6 +481,22 @@ function M.set_input(input_id)
 	return set_input(input_id)
 end
 
+---Switch to the input method after the current one in input_ids, wrapping
+---around, or to the first one if the current input method is not listed
+---@param input_ids string[] Input method IDs to toggle between (at least two)
+---@return string|nil input_id The input method switched to, or nil if failed
+function M.toggle_input(input_ids)
+	if not input_ids or #input_ids < 2 then
+		log("toggle_input needs at least two input method IDs")
+		return nil
+	end
+	local result = execute_command("toggle " .. shell_args(input_ids))
+	if result then
+		log("Toggled to: " .. result)
+	end
+	return result
+end
+
 ---List all available input methods
 ---@return string[] inputs Array of available input method IDs
 function M.list_inputs()
@@ -15,6 +15,9 @@ local function mock_vim()
 			fnamemodify = function(path, modifier)
 				return "/test/path"
 			end,
+			shellescape = function(str)
+				return "'" .. str:gsub("'", "'\\''") .. "'"
+			end,
 		},
 		tbl_deep_extend = function(behavior, ...)
 			local result = {}
@@ -126,6 +129,18 @@ function M.test_set_input()
 	assert_true(result, "set_input should return true for valid input")
 end
 
+function M.test_toggle_input_quotes_ids()
+	local popen = io.popen
+	local command
+	io.popen = function(cmd)
+		command = cmd
+		return popen(cmd)
+	end
+	im_switch.toggle_input({ "us", "us(intl)" })
+	io.popen = popen
+	assert_true(command:find("toggle 'us' 'us(intl)'", 1, true) ~= nil, "toggle_input should quote each ID")
+end
+
 function M.test_restore_input()
 	im_switch.restore_input()
 end
@@ -137,6 +152,7 @@ function M.run_all_tests()
 		"test_list_inputs",
 		"test_switch_to_english",
 		"test_set_input",
+		"test_toggle_input_quotes_ids",
 		"test_restore_input",
 	}
 
@@ -2,9 +2,11 @@
 
 ---@class ImSwitchConfig
 ---@field binary_path? string Path to the im-switch binary
----@field default_input? string Default input method ID to switch to
+---@field default_input? string|string[] Default input method ID to switch to, or several IDs of which the first one the backend has is used
 ---@field auto_switch? boolean Automatically switch to default input in normal mode
 ---@field auto_restore? boolean Automatically restore previous input in insert mode (experimental)
+---@field server? boolean Keep one `im-switch serve --stdio` process running for reading and switching instead of starting the binary each time
+---@field server_timeout? integer Milliseconds to wait for a response from the server before falling back to running the binary
 ---@field debug? boolean Enable debug logging
 
 ---@class ImSwitch
@@ -29,6 +31,12 @@ function ImSwitch.get_current() end
 ---@return boolean success True if successful, false otherwise
 function ImSwitch.set_input(input_id) end
 
+---Switch to the input method after the current one in input_ids, wrapping
+---around, or to the first one if the current input method is not listed
+---@param input_ids string[] Input method IDs to toggle between (at least two)
+---@return string|nil input_id The input method switched to, or nil if failed
+function ImSwitch.toggle_input(input_ids) end
+
 ---List all available input methods
 ---@return string[] inputs Array of available input method IDs
 function ImSwitch.list_inputs() end
@@ -1,84 +1,423 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"os"
 	"runtime"
+	"strings"
+	"time"
+
+	"github.com/chojs23/im-switch/imswitch"
+)
+
+// Exit codes used by the CLI. They are part of the documented interface.
+const (
+	exitOK                 = 0
+	exitFailure            = 1
+	exitUsage              = 2
+	exitBackendUnavailable = 3
+	exitUnknownSource      = 4
+	exitCommandFailed      = 5
+	exitTimeout            = 6
+	exitPermissionDenied   = 7
+	exitMismatch           = 8
 )
 
-func printUsage() {
-	fmt.Println("Usage:")
-	fmt.Println("  im-switch                    # Show current input source")
-	fmt.Println("  im-switch -l                 # List all input sources")
-	fmt.Println("  im-switch [input-source-id]  # Switch to input source")
-	fmt.Println("")
-	fmt.Println("Examples:")
+// command is a CLI subcommand.
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(c *cli, args []string) int
+}
+
+// commands lists the subcommands in the order they appear in the usage text.
+var commands []command
+
+func init() {
+	commands = []command{
+		{"get", "", "Show the current input source", runGet},
+		{"set", "<id> [id...]", "Switch to an input source, or the first available of several", runSet},
+		{"list", "", "List all input sources", runList},
+		{"toggle", "<id> <id>...", "Switch to the next of several input sources", runToggle},
+		{"cycle", "[id...]", "Switch to the next source in a ring", runCycle},
+		{"save", "<slot>", "Remember the current source under a name", runSave},
+		{"restore", "<slot>", "Switch back to a source remembered with save", runRestore},
+		{"push", "[id]", "Push the current source on a stack, then switch to id", runPush},
+		{"pop", "", "Switch back to the source on top of the stack", runPop},
+		{"exec", "[--] <command> [args...]", "Run a command under an input source, then switch back", runExec},
+		{"wait-for", "<id>", "Wait until an input source is active", runWaitFor},
+		{"watch", "", "Print the input source every time it changes", runWatch},
+		{"detect", "", "Show which backend is used and why", runDetect},
+		{"doctor", "", "Check that input switching works on this system", runDoctor},
+		{"serve", "--stdio", "Answer commands read from stdin with JSON lines", runServe},
+		{"version", "", "Show version information", runVersion},
+		{"completion", "bash|zsh|fish", "Print a shell completion script", runCompletion},
+		{"help", "[command]", "Show help for a command", runHelp},
+		{"__complete", "[word...]", "Print completions for the given words", runComplete},
+	}
+}
+
+// hiddenCommand reports whether a command is internal and left out of the
+// usage text, such as __complete which the completion scripts call.
+func hiddenCommand(name string) bool {
+	return strings.HasPrefix(name, "__")
+}
+
+func lookupCommand(name string) *command {
+	for i := range commands {
+		if commands[i].name == name {
+			return &commands[i]
+		}
+	}
+	return nil
+}
+
+// cli carries the output streams and global options of one invocation.
+type cli struct {
+	// stdin is read by serve; nil means os.Stdin.
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+	opts   globalOptions
+	// flags is the FlagSet of the running command, kept so that completion
+	// can list a command's flags.
+	flags *flag.FlagSet
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage:")
+	fmt.Fprintln(w, "  im-switch [options] <command> [arguments]")
+	fmt.Fprintln(w, "  im-switch [options]                    # Show current input source")
+	fmt.Fprintln(w, "  im-switch [options] -l                 # List all input sources")
+	fmt.Fprintln(w, "  im-switch [options] [input-source-id]  # Switch to input source")
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "Commands:")
+	for _, cmd := range commands {
+		if hiddenCommand(cmd.name) {
+			continue
+		}
+		fmt.Fprintf(w, "  %-10s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "Run 'im-switch help <command>' for the options of a command.")
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "Options:")
+	fmt.Fprintf(w, "  --backend <name>   Use the named backend instead of detecting one (%s)\n", strings.Join(imswitch.BackendNames(), ", "))
+	fmt.Fprintf(w, "                     Can also be set with the %s environment variable\n", imswitch.BackendEnvVar)
+	fmt.Fprintln(w, "  --json             Write output and errors as JSON on stdout")
+	fmt.Fprintf(w, "  --timeout <dur>    Give up on the backend after this long (default %s, 0 disables)\n", imswitch.DefaultTimeout)
+	fmt.Fprintf(w, "  --verify           Check that switches take effect, retrying %d times before failing\n", imswitch.DefaultVerifyRetries)
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "Exit codes:")
+	fmt.Fprintln(w, "  0  success")
+	fmt.Fprintln(w, "  1  other error")
+	fmt.Fprintln(w, "  2  invalid usage")
+	fmt.Fprintln(w, "  3  backend unavailable")
+	fmt.Fprintln(w, "  4  unknown or ambiguous input source")
+	fmt.Fprintln(w, "  5  backend command failed")
+	fmt.Fprintln(w, "  6  timed out")
+	fmt.Fprintln(w, "  7  permission denied")
+	fmt.Fprintln(w, "  8  input source did not change (with --verify)")
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "Examples:")
 	if runtime.GOOS == "darwin" {
-		fmt.Println("  # macOS")
-		fmt.Println("  im-switch com.apple.keylayout.ABC")
-		fmt.Println("  im-switch com.apple.inputmethod.Korean.2SetKorean")
+		fmt.Fprintln(w, "  # macOS")
+		fmt.Fprintln(w, "  im-switch com.apple.keylayout.ABC")
+		fmt.Fprintln(w, "  im-switch com.apple.inputmethod.Korean.2SetKorean")
 	} else if runtime.GOOS == "windows" {
-		fmt.Println("  # Windows")
-		fmt.Println("  im-switch en-US                 # English (United States)")
-		fmt.Println("  im-switch 00000409              # English (United States) by layout ID")
-		fmt.Println("  im-switch de-DE                 # German (Germany)")
-		fmt.Println("  im-switch ja-JP                 # Japanese")
+		fmt.Fprintln(w, "  # Windows")
+		fmt.Fprintln(w, "  im-switch en-US                 # English (United States)")
+		fmt.Fprintln(w, "  im-switch 00000409              # English (United States) by layout ID")
+		fmt.Fprintln(w, "  im-switch de-DE                 # German (Germany)")
+		fmt.Fprintln(w, "  im-switch ja-JP                 # Japanese")
 	} else {
-		fmt.Println("  # Linux")
-		fmt.Println("  im-switch us                    # XKB layout")
-		fmt.Println("  im-switch xkb:us::eng           # IBus")
-		fmt.Println("  im-switch keyboard-us           # Fcitx")
+		fmt.Fprintln(w, "  # Linux")
+		fmt.Fprintln(w, "  im-switch us                    # XKB layout")
+		fmt.Fprintln(w, "  im-switch xkb:us::eng           # IBus")
+		fmt.Fprintln(w, "  im-switch keyboard-us           # Fcitx")
+		fmt.Fprintln(w, "  im-switch --backend fcitx5 list # Force Fcitx5")
 	}
-	fmt.Println("")
-	fmt.Printf("Platform: %s\n", runtime.GOOS)
+	fmt.Fprintln(w, "")
+	fmt.Fprintf(w, "Platform: %s\n", runtime.GOOS)
 }
 
-func main() {
-	args := os.Args[1:]
-
-	switch len(args) {
-	case 0:
-		current := getCurrentInputSource()
-		if current == "" {
-			if runtime.GOOS == "linux" {
-				fmt.Fprintf(os.Stderr, "Error: No input method framework detected\n")
-				fmt.Fprintf(os.Stderr, "Please install one of: ibus, fcitx, fcitx5, or ensure setxkbmap is available\n")
-			} else {
-				fmt.Fprintf(os.Stderr, "Error: Could not get current input source\n")
-			}
-			os.Exit(1)
-		}
-		fmt.Println(current)
+// globalOptions are options that apply to every command.
+type globalOptions struct {
+	backend string
+	json    bool
+	timeout time.Duration
+	// timeoutSet records whether --timeout was given, for commands whose
+	// default differs from imswitch.DefaultTimeout.
+	timeoutSet bool
+	// verify makes switches read the source back and retry, see
+	// imswitch.WithVerify.
+	verify bool
+	// switchers, when set, reuses Switchers across the requests of serve.
+	switchers switcherCache
+}
+
+// switcher returns a Switcher configured by the global options.
+func (opts globalOptions) switcher() *imswitch.Switcher {
+	key := switcherKey{opts.backend, opts.timeout, opts.verify}
+	if s, ok := opts.switchers[key]; ok {
+		return s
+	}
+	if opts.switchers == nil {
+		return opts.newSwitcher()
+	}
+	s := opts.newSwitcher(imswitch.WithListCache())
+	opts.switchers[key] = s
+	return s
+}
+
+// newSwitcher returns a Switcher configured by the global options and extra,
+// bypassing the serve cache.
+func (opts globalOptions) newSwitcher(extra ...imswitch.Option) *imswitch.Switcher {
+	options := []imswitch.Option{imswitch.WithBackend(opts.backend), imswitch.WithTimeout(opts.timeout)}
+	if opts.verify {
+		options = append(options, imswitch.WithVerify(imswitch.DefaultVerifyRetries))
+	}
+	return imswitch.New(append(options, extra...)...)
+}
+
+func parseTimeout(value string) (time.Duration, error) {
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout < 0 {
+		return 0, fmt.Errorf("invalid --timeout '%s' (use e.g. 500ms or 2s)", value)
+	}
+	return timeout, nil
+}
 
-	case 1:
+// parseGlobalFlags extracts options that apply to every command from the
+// front of args and returns the remaining arguments.
+func parseGlobalFlags(args []string) (opts globalOptions, rest []string, err error) {
+	opts.timeout = imswitch.DefaultTimeout
+	for len(args) > 0 {
 		arg := args[0]
-		if arg == "-l" || arg == "--list" {
-			sources := getAllInputSources()
-			if sources == nil {
-				if runtime.GOOS == "linux" {
-					fmt.Fprintf(os.Stderr, "Error: No input method framework detected\n")
-					fmt.Fprintf(os.Stderr, "Please install one of: ibus, fcitx, fcitx5, or ensure setxkbmap is available\n")
-				} else {
-					fmt.Fprintf(os.Stderr, "Error: Could not get input sources\n")
-				}
-				os.Exit(1)
+		switch {
+		case arg == "--backend":
+			if len(args) < 2 || args[1] == "" {
+				return globalOptions{}, nil, fmt.Errorf("--backend requires a backend name")
+			}
+			opts.backend = args[1]
+			args = args[2:]
+		case strings.HasPrefix(arg, "--backend="):
+			opts.backend = strings.TrimPrefix(arg, "--backend=")
+			if opts.backend == "" {
+				return globalOptions{}, nil, fmt.Errorf("--backend requires a backend name")
+			}
+			args = args[1:]
+		case arg == "--timeout":
+			if len(args) < 2 {
+				return globalOptions{}, nil, fmt.Errorf("--timeout requires a duration")
+			}
+			if opts.timeout, err = parseTimeout(args[1]); err != nil {
+				return globalOptions{}, nil, err
 			}
-			for _, source := range sources {
-				fmt.Println(source)
+			opts.timeoutSet = true
+			args = args[2:]
+		case strings.HasPrefix(arg, "--timeout="):
+			if opts.timeout, err = parseTimeout(strings.TrimPrefix(arg, "--timeout=")); err != nil {
+				return globalOptions{}, nil, err
 			}
-		} else if arg == "-h" || arg == "--help" {
-			printUsage()
-		} else {
-			if !setInputSource(arg) {
-				fmt.Fprintf(os.Stderr, "Error: Could not set input source to '%s'\n", arg)
-				fmt.Fprintf(os.Stderr, "Use 'im-switch -l' to see available input sources\n")
-				os.Exit(1)
+			opts.timeoutSet = true
+			args = args[1:]
+		case arg == "--json":
+			opts.json = true
+			args = args[1:]
+		case arg == "--verify":
+			opts.verify = true
+			args = args[1:]
+		default:
+			return opts, args, nil
+		}
+	}
+	return opts, args, nil
+}
+
+// flagSet returns a FlagSet for cmd that also accepts the global options, so
+// they can be given after the command name as well as before it.
+func (c *cli) flagSet(cmd *command) *flag.FlagSet {
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	fs.Usage = func() { c.printCommandUsage(fs, cmd) }
+	c.flags = fs
+
+	fs.StringVar(&c.opts.backend, "backend", c.opts.backend, "use the named backend instead of detecting one")
+	fs.BoolVar(&c.opts.json, "json", c.opts.json, "write output and errors as JSON on stdout")
+	fs.Func("timeout", "give up on the backend after this `duration` (0 disables)", func(value string) error {
+		timeout, err := parseTimeout(value)
+		if err == nil {
+			c.opts.timeout, c.opts.timeoutSet = timeout, true
+		}
+		return err
+	})
+	fs.BoolVar(&c.opts.verify, "verify", c.opts.verify, "check that switches take effect, retrying before failing")
+	return fs
+}
+
+func (c *cli) printCommandUsage(fs *flag.FlagSet, cmd *command) {
+	w := fs.Output()
+	fmt.Fprintf(w, "Usage: im-switch %s [options]", cmd.name)
+	if cmd.args != "" {
+		fmt.Fprintf(w, " %s", cmd.args)
+	}
+	fmt.Fprintf(w, "\n\n%s\n\nOptions:\n", cmd.summary)
+	fs.PrintDefaults()
+}
+
+// parseFlags parses args with fs, allowing flags to follow positional
+// arguments. It returns the positional arguments, or ok=false with the exit
+// code to use when parsing failed or help was requested.
+func parseFlags(fs *flag.FlagSet, args []string) (positional []string, code int, ok bool) {
+	for {
+		if err := fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return nil, exitOK, false
 			}
+			return nil, exitUsage, false
 		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, exitOK, true
+		}
+		if args[0] == "--" {
+			return append(positional, args[1:]...), exitOK, true
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
 
+// exitCode maps err to the CLI exit code for its kind.
+func exitCode(err error) int {
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, imswitch.ErrBackendUnavailable):
+		return exitBackendUnavailable
+	case errors.Is(err, imswitch.ErrUnknownSource), errors.Is(err, imswitch.ErrAmbiguousSource):
+		return exitUnknownSource
+	case errors.Is(err, imswitch.ErrCommandFailed):
+		return exitCommandFailed
+	case errors.Is(err, imswitch.ErrTimeout):
+		return exitTimeout
+	case errors.Is(err, imswitch.ErrPermissionDenied):
+		return exitPermissionDenied
+	case errors.Is(err, imswitch.ErrMismatch):
+		return exitMismatch
 	default:
-		fmt.Fprintf(os.Stderr, "Error: Too many arguments\n\n")
-		printUsage()
-		os.Exit(1)
+		return exitFailure
+	}
+}
+
+// jsonError is the object written to stdout for failures in --json mode.
+type jsonError struct {
+	Code       string   `json:"code"`
+	Message    string   `json:"message"`
+	Backend    string   `json:"backend,omitempty"`
+	Source     string   `json:"source,omitempty"`
+	Detail     string   `json:"detail,omitempty"`
+	Candidates []string `json:"candidates,omitempty"`
+	ExitCode   int      `json:"exit_code"`
+}
+
+func writeJSON(w io.Writer, v any) {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(v)
+}
+
+// reportError prints err in the requested format and returns the exit code.
+func (c *cli) reportError(err error) int {
+	code := exitCode(err)
+
+	if c.opts.json {
+		payload := jsonError{Code: imswitch.ErrorCode(err), Message: err.Error(), ExitCode: code}
+		var e *imswitch.Error
+		if errors.As(err, &e) {
+			payload.Backend = e.Backend
+			payload.Source = e.Source
+			payload.Detail = e.Detail
+			payload.Candidates = e.Candidates
+		}
+		writeJSON(c.stdout, map[string]jsonError{"error": payload})
+		return code
+	}
+
+	if err == imswitch.ErrNoBackendDetected {
+		c.printNoBackendError()
+		return code
 	}
+	fmt.Fprintf(c.stderr, "Error: %v\n", err)
+	if errors.Is(err, imswitch.ErrUnknownSource) || errors.Is(err, imswitch.ErrAmbiguousSource) {
+		fmt.Fprintf(c.stderr, "Use 'im-switch list' to see available input sources\n")
+	}
+	return code
+}
+
+func (c *cli) printNoBackendError() {
+	if runtime.GOOS == "linux" {
+		fmt.Fprintf(c.stderr, "Error: No input method framework detected\n")
+		fmt.Fprintf(c.stderr, "Please install one of: ibus, fcitx, fcitx5, or ensure setxkbmap is available\n")
+		fmt.Fprintf(c.stderr, "Use --backend or %s to select one explicitly\n", imswitch.BackendEnvVar)
+	} else {
+		fmt.Fprintf(c.stderr, "Error: No input source backend available\n")
+	}
+}
+
+// usageError prints msg followed by a hint to the usage text and returns
+// exitUsage.
+func (c *cli) usageError(msg string) int {
+	fmt.Fprintf(c.stderr, "Error: %s\n", msg)
+	fmt.Fprintf(c.stderr, "Run 'im-switch --help' for usage\n")
+	return exitUsage
+}
+
+// run executes the CLI with the given arguments and returns the exit code.
+func run(args []string, stdout, stderr io.Writer) int {
+	c := &cli{stdout: stdout, stderr: stderr}
+
+	opts, args, err := parseGlobalFlags(args)
+	if err != nil {
+		return c.usageError(err.Error())
+	}
+	c.opts = opts
+
+	if len(args) == 0 {
+		return runGet(c, nil)
+	}
+
+	name := args[0]
+	if cmd := lookupCommand(name); cmd != nil {
+		return cmd.run(c, args[1:])
+	}
+	switch {
+	case name == "-h" || name == "--help":
+		printUsage(c.stdout)
+		return exitOK
+	case name == "-l" || name == "--list":
+		return runList(c, args[1:])
+	case name == "--version":
+		return runVersion(c, args[1:])
+	case name == "--stdio":
+		return runServe(c, args)
+	case strings.HasPrefix(name, "-"):
+		return c.usageError(fmt.Sprintf("unknown option '%s'", name))
+	case len(args) > 1:
+		return c.usageError(fmt.Sprintf("unknown command '%s'", name))
+	default:
+		// A bare input source ID, kept for backward compatibility.
+		return runSet(c, args)
+	}
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
 }
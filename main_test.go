@@ -1,128 +1,148 @@
 package main
 
 import (
-	"runtime"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/chojs23/im-switch/imswitch"
 )
 
-func TestGetCurrentInputSource(t *testing.T) {
-	current := getCurrentInputSource()
-	if current == "" {
-		t.Error("getCurrentInputSource() returned empty string")
+func TestParseGlobalFlags(t *testing.T) {
+	testCases := []struct {
+		args        []string
+		backendName string
+		json        bool
+		timeout     time.Duration
+		rest        []string
+		wantErr     bool
+	}{
+		{[]string{}, "", false, imswitch.DefaultTimeout, []string{}, false},
+		{[]string{"-l"}, "", false, imswitch.DefaultTimeout, []string{"-l"}, false},
+		{[]string{"--backend", "fcitx5", "-l"}, "fcitx5", false, imswitch.DefaultTimeout, []string{"-l"}, false},
+		{[]string{"--backend=xkb", "us"}, "xkb", false, imswitch.DefaultTimeout, []string{"us"}, false},
+		{[]string{"--json", "--backend", "ibus", "hangul"}, "ibus", true, imswitch.DefaultTimeout, []string{"hangul"}, false},
+		{[]string{"--timeout", "2s", "-l"}, "", false, 2 * time.Second, []string{"-l"}, false},
+		{[]string{"--timeout=0"}, "", false, 0, []string{}, false},
+		{[]string{"--backend"}, "", false, 0, nil, true},
+		{[]string{"--backend="}, "", false, 0, nil, true},
+		{[]string{"--timeout", "soon"}, "", false, 0, nil, true},
+		{[]string{"--timeout=-1s"}, "", false, 0, nil, true},
+	}
+
+	for _, tc := range testCases {
+		opts, rest, err := parseGlobalFlags(tc.args)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("parseGlobalFlags(%v) error = %v, wantErr %v", tc.args, err, tc.wantErr)
+			continue
+		}
+		if opts.backend != tc.backendName {
+			t.Errorf("parseGlobalFlags(%v) backend = %q, want %q", tc.args, opts.backend, tc.backendName)
+		}
+		if opts.json != tc.json {
+			t.Errorf("parseGlobalFlags(%v) json = %v, want %v", tc.args, opts.json, tc.json)
+		}
+		if !tc.wantErr && opts.timeout != tc.timeout {
+			t.Errorf("parseGlobalFlags(%v) timeout = %v, want %v", tc.args, opts.timeout, tc.timeout)
+		}
+		if len(rest) != len(tc.rest) {
+			t.Errorf("parseGlobalFlags(%v) rest = %v, want %v", tc.args, rest, tc.rest)
+			continue
+		}
+		for i := range rest {
+			if rest[i] != tc.rest[i] {
+				t.Errorf("parseGlobalFlags(%v) rest = %v, want %v", tc.args, rest, tc.rest)
+				break
+			}
+		}
 	}
 }
 
-func TestGetAllInputSources(t *testing.T) {
-	sources := getAllInputSources()
-	if sources == nil {
-		t.Error("getAllInputSources() returned nil")
-		return
-	}
-	if len(sources) == 0 {
-		t.Error("getAllInputSources() returned empty slice")
+func TestExitCode(t *testing.T) {
+	testCases := []struct {
+		err      error
+		expected int
+	}{
+		{nil, exitOK},
+		{errors.New("boom"), exitFailure},
+		{&imswitch.Error{Kind: imswitch.ErrBackendUnavailable}, exitBackendUnavailable},
+		{&imswitch.Error{Kind: imswitch.ErrUnknownSource, Source: "x"}, exitUnknownSource},
+		{&imswitch.Error{Kind: imswitch.ErrCommandFailed}, exitCommandFailed},
+		{&imswitch.Error{Kind: imswitch.ErrTimeout}, exitTimeout},
+		{&imswitch.Error{Kind: imswitch.ErrPermissionDenied}, exitPermissionDenied},
+		{fmt.Errorf("wrapped: %w", &imswitch.Error{Kind: imswitch.ErrUnknownSource}), exitUnknownSource},
+	}
+
+	for _, tc := range testCases {
+		if got := exitCode(tc.err); got != tc.expected {
+			t.Errorf("exitCode(%v) = %d, want %d", tc.err, got, tc.expected)
+		}
 	}
 }
 
-func TestSetInputSourceWithInvalidID(t *testing.T) {
-	invalidID := "invalid-input-source-id-that-should-not-exist"
-	result := setInputSource(invalidID)
-	if result {
-		t.Error("setInputSource() should return false for invalid input source")
+func TestWriteDetectionReport(t *testing.T) {
+	report := imswitch.DetectionReport{
+		Selected: "a",
+		Probes: []imswitch.ProbeReport{
+			{Name: "daemon", Observations: []string{"a-daemon is running"}, Result: "a"},
+		},
+		Rejected: []imswitch.BackendRejection{{Backend: "b", Reason: "not available on this system"}},
 	}
-}
 
-func TestSetInputSourceWithCurrentID(t *testing.T) {
-	current := getCurrentInputSource()
-	if current == "" {
-		t.Skip("Cannot get current input source, skipping test")
-	}
+	var out bytes.Buffer
+	writeDetectionReport(&out, report)
 
-	result := setInputSource(current)
-	if !result {
-		t.Error("setInputSource() should return true when setting to current input source")
+	for _, want := range []string{"Probe daemon:", "  a-daemon is running", "  => a", "Selected: a", "Rejected: b (not available on this system)"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Report output missing %q:\n%s", want, out.String())
+		}
 	}
 }
 
-func TestPlatformSpecificFunctions(t *testing.T) {
-	if runtime.GOOS == "darwin" {
-		testDarwinFunctions(t)
-	} else if runtime.GOOS == "linux" {
-		testLinuxFunctions(t)
-	} else {
-		t.Skip("Unsupported platform")
+func TestWriteSourceTable(t *testing.T) {
+	sources := []imswitch.InputSource{
+		{ID: "xkb:us::eng", Name: "English (US)", Language: "en", Backend: "ibus", Kind: imswitch.KindLayout},
+		{ID: "hangul", Backend: "ibus", Kind: imswitch.KindInputMethod},
 	}
-}
 
-func testDarwinFunctions(t *testing.T) {
-	current := getCurrentInputSource()
-	if current == "" {
-		t.Error("macOS getCurrentInputSource() returned empty string")
-	}
+	var out bytes.Buffer
+	writeSourceTable(&out, sources)
 
-	sources := getAllInputSources()
-	if len(sources) == 0 {
-		t.Error("macOS getAllInputSources() returned no sources")
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected header and 2 rows, got:\n%s", out.String())
 	}
-
-	found := false
-	for _, source := range sources {
-		if source == current {
-			found = true
-			break
-		}
+	if fields := strings.Fields(lines[1]); len(fields) < 4 || fields[0] != "xkb:us::eng" || fields[1] != "layout" || fields[2] != "en" {
+		t.Errorf("Unexpected row for xkb:us::eng: %q", lines[1])
 	}
-	if !found {
-		t.Error("Current input source not found in available sources list")
+	if fields := strings.Fields(lines[2]); len(fields) != 4 || fields[2] != "-" || fields[3] != "-" {
+		t.Errorf("Missing fields should be shown as '-': %q", lines[2])
 	}
 }
 
-func testLinuxFunctions(t *testing.T) {
-	current := getCurrentInputSource()
-	if current == "" {
-		t.Error("Linux getCurrentInputSource() returned empty string")
+func TestJSONSource(t *testing.T) {
+	source := jsonSource{
+		InputSource: imswitch.InputSource{ID: "hangul", Backend: "ibus", Kind: imswitch.KindInputMethod},
+		Current:     true,
 	}
 
-	sources := getAllInputSources()
-	if len(sources) == 0 {
-		t.Error("Linux getAllInputSources() returned no sources")
-	}
-}
+	var out bytes.Buffer
+	writeJSON(&out, source)
 
-func TestInputSourceToggling(t *testing.T) {
-	originalSource := getCurrentInputSource()
-	if originalSource == "" {
-		t.Skip("Cannot get current input source, skipping toggle test")
+	var decoded map[string]any
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatalf("Output is not valid JSON: %v\n%s", err, out.String())
 	}
-
-	sources := getAllInputSources()
-	if len(sources) < 2 {
-		t.Skip("Need at least 2 input sources for toggle test")
-	}
-
-	var alternativeSource string
-	for _, source := range sources {
-		if source != originalSource {
-			alternativeSource = source
-			break
+	for _, key := range []string{"id", "name", "language", "backend", "kind", "current"} {
+		if _, ok := decoded[key]; !ok {
+			t.Errorf("JSON output is missing %q: %s", key, out.String())
 		}
 	}
-
-	if alternativeSource == "" {
-		t.Skip("Could not find alternative input source")
-	}
-
-	if !setInputSource(alternativeSource) {
-		t.Error("Failed to switch to alternative input source")
-		return
-	}
-
-	current := getCurrentInputSource()
-	if current != alternativeSource {
-		t.Errorf("Expected input source %s, got %s", alternativeSource, current)
-	}
-
-	if !setInputSource(originalSource) {
-		t.Error("Failed to restore original input source")
+	if decoded["current"] != true {
+		t.Errorf("Expected current to be true, got %v", decoded["current"])
 	}
 }
-
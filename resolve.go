@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/chojs23/im-switch/imswitch"
+)
+
+// sourceResolver turns the input sources named on the command line into
+// backend IDs. Aliases from the config file are applied first; other names
+// are matched against the backend's list, which is read at most once.
+type sourceResolver struct {
+	switcher *imswitch.Switcher
+	cfg      config
+
+	listed  bool
+	sources []imswitch.InputSource
+	listErr error
+}
+
+func newResolver(switcher *imswitch.Switcher) (*sourceResolver, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	return &sourceResolver{switcher: switcher, cfg: cfg}, nil
+}
+
+// alias returns the ID that name is an alias for, or name itself.
+func (r *sourceResolver) alias(name string) string {
+	if id, ok := r.cfg.Aliases[name]; ok {
+		return id
+	}
+	return name
+}
+
+func (r *sourceResolver) list(ctx context.Context) ([]imswitch.InputSource, error) {
+	if !r.listed {
+		r.sources, r.listErr = r.switcher.List(ctx)
+		r.listed = true
+	}
+	return r.sources, r.listErr
+}
+
+// resolve returns the ID of the source that name refers to. Names that match
+// nothing are returned unchanged, since some backends accept IDs they do not
+// list; only an ambiguous name is an error.
+func (r *sourceResolver) resolve(ctx context.Context, name string) (string, error) {
+	if id, ok := r.cfg.Aliases[name]; ok {
+		return id, nil
+	}
+	sources, err := r.list(ctx)
+	if err != nil {
+		// Leave it to the switch to report the backend failure.
+		return name, nil
+	}
+	source, err := imswitch.ResolveSource(sources, name)
+	switch {
+	case err == nil:
+		return source.ID, nil
+	case errors.Is(err, imswitch.ErrAmbiguousSource):
+		return "", err
+	default:
+		return name, nil
+	}
+}
+
+// resolveAll resolves each of names.
+func (r *sourceResolver) resolveAll(ctx context.Context, names []string) ([]string, error) {
+	ids := make([]string, 0, len(names))
+	for _, name := range names {
+		id, err := r.resolve(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// setFirst resolves each of names like resolve and switches to the first
+// one available, see imswitch.Switcher.SetFirst. It returns the chosen ID.
+func (r *sourceResolver) setFirst(ctx context.Context, names []string) (string, error) {
+	ids, err := r.resolveAll(ctx, names)
+	if err != nil {
+		return "", err
+	}
+	return r.switcher.SetFirst(ctx, ids...)
+}
+
+// set switches to the source that name refers to and returns its ID. The
+// name is tried as an ID first, so that the common case costs no more
+// backend calls than a plain switch; only a rejected name is resolved.
+func (r *sourceResolver) set(ctx context.Context, name string) (string, error) {
+	id := r.alias(name)
+	err := r.switcher.Set(ctx, id)
+	if err == nil || !(errors.Is(err, imswitch.ErrUnknownSource) || errors.Is(err, imswitch.ErrCommandFailed)) {
+		return id, err
+	}
+
+	sources, listErr := r.list(ctx)
+	if listErr != nil {
+		return id, err
+	}
+	source, resolveErr := imswitch.ResolveSource(sources, id)
+	switch {
+	case resolveErr != nil && errors.Is(err, imswitch.ErrUnknownSource):
+		// Report the ambiguity or the suggestions rather than the bare
+		// rejection.
+		return id, resolveErr
+	case resolveErr != nil || source.ID == id:
+		return id, err
+	}
+	return source.ID, r.switcher.Set(ctx, source.ID)
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/chojs23/im-switch/imswitch"
+)
+
+// maxRequestSize bounds one request line of `serve --stdio`.
+const maxRequestSize = 64 * 1024
+
+// unservedCommands cannot run inside `serve`: they stream, take over the
+// terminal or print text rather than JSON.
+var unservedCommands = map[string]bool{
+	"serve":      true,
+	"watch":      true,
+	"exec":       true,
+	"completion": true,
+	"help":       true,
+	"__complete": true,
+}
+
+// serveResponse is one line of `serve --stdio` output.
+type serveResponse struct {
+	OK     bool            `json:"ok"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  *jsonError      `json:"error,omitempty"`
+}
+
+// switcherKey identifies the options a Switcher was built with.
+type switcherKey struct {
+	backend string
+	timeout time.Duration
+	verify  bool
+}
+
+// switcherCache keeps the Switchers of a `serve` session, so that the backend
+// is detected once rather than on every request.
+type switcherCache map[switcherKey]*imswitch.Switcher
+
+// runServe implements `im-switch serve`. It reads one command per line from
+// stdin and answers each with one line of JSON on stdout.
+func runServe(c *cli, args []string) int {
+	fs := c.flagSet(lookupCommand("serve"))
+	stdio := fs.Bool("stdio", false, "read commands from stdin and write responses to stdout")
+	positional, code, ok := parseFlags(fs, args)
+	if !ok {
+		return code
+	}
+	switch {
+	case len(positional) > 0:
+		return c.usageError("serve takes no arguments")
+	case !*stdio:
+		return c.usageError("serve requires --stdio")
+	}
+
+	opts := c.opts
+	opts.json = true
+	opts.switchers = switcherCache{}
+
+	encoder := json.NewEncoder(c.stdout)
+	encoder.SetEscapeHTML(false)
+	stdin := c.stdin
+	if stdin == nil {
+		stdin = os.Stdin
+	}
+	scanner := bufio.NewScanner(stdin)
+	scanner.Buffer(make([]byte, 0, 4096), maxRequestSize)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		encoder.Encode(serveRequest(opts, line))
+	}
+	if err := scanner.Err(); err != nil {
+		return c.reportError(err)
+	}
+	return exitOK
+}
+
+// serveRequest runs the command on line and returns its response. A line is
+// either words separated by spaces, as on the command line, or a JSON array
+// of strings for arguments that contain spaces.
+func serveRequest(opts globalOptions, line string) serveResponse {
+	var args []string
+	if strings.HasPrefix(line, "[") {
+		if err := json.Unmarshal([]byte(line), &args); err != nil {
+			return usageResponse(fmt.Sprintf("invalid request: %v", err))
+		}
+	} else {
+		args = strings.Fields(line)
+	}
+	if len(args) == 0 {
+		return usageResponse("empty request")
+	}
+
+	cmd := lookupCommand(args[0])
+	switch {
+	case cmd == nil:
+		return usageResponse(fmt.Sprintf("unknown command '%s'", args[0]))
+	case unservedCommands[cmd.name]:
+		return usageResponse(fmt.Sprintf("%s is not available in serve", cmd.name))
+	}
+
+	var stdout, stderr bytes.Buffer
+	code := cmd.run(&cli{stdout: &stdout, stderr: &stderr, opts: opts}, args[1:])
+	msg, _, _ := strings.Cut(strings.TrimSpace(stderr.String()), "\n")
+	msg = strings.TrimPrefix(msg, "Error: ")
+
+	switch code {
+	case exitOK:
+		return serveResponse{OK: true, Result: compactJSON(stdout.Bytes())}
+	case exitUsage:
+		return usageResponse(msg)
+	}
+	var payload map[string]*jsonError
+	if json.Unmarshal(stdout.Bytes(), &payload) == nil && payload["error"] != nil {
+		return serveResponse{Error: payload["error"]}
+	}
+	// Commands such as doctor fail with a regular report rather than an
+	// error object.
+	if msg == "" {
+		msg = fmt.Sprintf("%s failed with exit code %d", cmd.name, code)
+	}
+	return serveResponse{
+		Result: compactJSON(stdout.Bytes()),
+		Error:  &jsonError{Code: "error", Message: msg, ExitCode: code},
+	}
+}
+
+func usageResponse(msg string) serveResponse {
+	return serveResponse{Error: &jsonError{Code: "usage", Message: msg, ExitCode: exitUsage}}
+}
+
+// compactJSON puts the indented JSON that commands print on one line. It
+// returns nil for empty or invalid output.
+func compactJSON(data []byte) json.RawMessage {
+	var b bytes.Buffer
+	if len(data) == 0 || json.Compact(&b, data) != nil {
+		return nil
+	}
+	return b.Bytes()
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/chojs23/im-switch/imswitch"
+)
+
+func TestRunServe(t *testing.T) {
+	b := useMemBackend(t)
+
+	requests := strings.Join([]string{
+		"get",
+		"",
+		"set kr",
+		`["set", "Test de"]`,
+		"set xx",
+		"list",
+		"set",
+		"watch",
+		"bogus",
+		`["unterminated`,
+		"get",
+	}, "\n")
+	var stdout, stderr bytes.Buffer
+	c := &cli{stdin: strings.NewReader(requests), stdout: &stdout, stderr: &stderr}
+	c.opts = globalOptions{backend: "test", timeout: imswitch.DefaultTimeout}
+	if code := runServe(c, []string{"--stdio"}); code != exitOK {
+		t.Fatalf("serve --stdio = %d (stderr: %q)", code, stderr.String())
+	}
+
+	lines := strings.Split(strings.TrimSuffix(stdout.String(), "\n"), "\n")
+	expected := []struct {
+		ok     bool
+		result string
+		code   string
+	}{
+		{true, `"id":"us"`, ""},
+		{true, `{"selected":"kr"}`, ""},
+		{true, `{"selected":"de"}`, ""},
+		{false, "", "unknown_source"},
+		{true, "", ""},
+		{false, "", "usage"},
+		{false, "", "usage"},
+		{false, "", "usage"},
+		{false, "", "usage"},
+		{true, `"id":"de"`, ""},
+	}
+	if len(lines) != len(expected) {
+		t.Fatalf("serve --stdio wrote %d lines, want %d:\n%s", len(lines), len(expected), stdout.String())
+	}
+	for i, want := range expected {
+		var response struct {
+			OK     bool            `json:"ok"`
+			Result json.RawMessage `json:"result"`
+			Error  *jsonError      `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(lines[i]), &response); err != nil {
+			t.Fatalf("response %d = %q: %v", i, lines[i], err)
+		}
+		if response.OK != want.ok {
+			t.Errorf("response %d = %s, want ok=%v", i, lines[i], want.ok)
+		}
+		if want.code != "" && (response.Error == nil || response.Error.Code != want.code) {
+			t.Errorf("response %d = %s, want error code %s", i, lines[i], want.code)
+		}
+		if want.result != "" && !strings.Contains(string(response.Result), want.result) {
+			t.Errorf("response %d = %s, want a result with %s", i, lines[i], want.result)
+		}
+	}
+	if strings.Join(b.sets, ",") != "kr,de" {
+		t.Errorf("sets = %v, want kr and de", b.sets)
+	}
+}
+
+func TestRunServeUsage(t *testing.T) {
+	useMemBackend(t)
+
+	if code, _, stderr := runCLI("serve"); code != exitUsage || !strings.Contains(stderr, "--stdio") {
+		t.Errorf("serve without --stdio = %d, %q", code, stderr)
+	}
+}
+
+func TestSwitcherCache(t *testing.T) {
+	opts := globalOptions{backend: "test", timeout: imswitch.DefaultTimeout, switchers: switcherCache{}}
+	if opts.switcher() != opts.switcher() {
+		t.Error("switcher() should reuse the cached Switcher")
+	}
+	other := opts
+	other.verify = true
+	if other.switcher() == opts.switcher() {
+		t.Error("switcher() should not share a Switcher across different options")
+	}
+
+	opts.switchers = nil
+	if opts.switcher() == opts.switcher() {
+		t.Error("switcher() should not cache without a cache")
+	}
+}
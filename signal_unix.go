@@ -0,0 +1,18 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// forwardedSignals are passed on to the child of `im-switch exec`. They are
+// usually aimed at im-switch alone, e.g. by kill or a closing terminal.
+var forwardedSignals = []os.Signal{syscall.SIGTERM, syscall.SIGHUP}
+
+// caughtSignals are only caught while the child runs, to keep im-switch
+// alive long enough to restore the input source. The terminal sends them to
+// the whole foreground process group, so the child already receives them and
+// forwarding would deliver them twice.
+var caughtSignals = []os.Signal{os.Interrupt, syscall.SIGQUIT}
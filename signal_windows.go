@@ -0,0 +1,14 @@
+//go:build windows
+
+package main
+
+import "os"
+
+// forwardedSignals are passed on to the child of `im-switch exec`. Windows
+// cannot send signals to another process.
+var forwardedSignals []os.Signal
+
+// caughtSignals are only caught while the child runs. The console already
+// delivers Ctrl-C to the child, so catching it only keeps im-switch alive
+// long enough to restore the input source.
+var caughtSignals = []os.Signal{os.Interrupt}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/chojs23/im-switch/imswitch"
+)
+
+// maxStackDepth bounds the push/pop stack; the oldest entries are dropped
+// first so that pushes without matching pops cannot grow the file forever.
+const maxStackDepth = 64
+
+// savedSource is an input source remembered by save or push.
+type savedSource struct {
+	imswitch.InputSource
+	SavedAt time.Time `json:"saved_at"`
+}
+
+// stateFile is the content of state.json.
+type stateFile struct {
+	Slots map[string]savedSource `json:"slots,omitempty"`
+	Stack []savedSource          `json:"stack,omitempty"`
+}
+
+// stateDir returns the directory that holds saved input state:
+// $XDG_STATE_HOME/im-switch, falling back to ~/.local/state/im-switch, or
+// im-switch under the local app data directory on Windows.
+func stateDir() (string, error) {
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, "im-switch"), nil
+	}
+	if runtime.GOOS == "windows" {
+		dir, err := os.UserCacheDir()
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(dir, "im-switch"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "state", "im-switch"), nil
+}
+
+// stateStore gives exclusive access to state.json for the lifetime of one
+// command, so that concurrent editors and shell hooks do not clobber each
+// other's updates.
+type stateStore struct {
+	path   string
+	unlock func()
+}
+
+// openState locks the state directory and returns the store. Callers must
+// call close when done.
+func openState() (*stateStore, error) {
+	dir, err := stateDir()
+	if err != nil {
+		return nil, fmt.Errorf("cannot locate state directory: %v", err)
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	unlock, err := lockFile(filepath.Join(dir, "state.lock"))
+	if err != nil {
+		return nil, fmt.Errorf("cannot lock state: %v", err)
+	}
+	return &stateStore{path: filepath.Join(dir, "state.json"), unlock: unlock}, nil
+}
+
+func (s *stateStore) close() {
+	s.unlock()
+}
+
+// load reads the state file. A missing file yields an empty state.
+func (s *stateStore) load() (stateFile, error) {
+	var state stateFile
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return state, err
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return state, fmt.Errorf("invalid state file %s: %v", s.path, err)
+	}
+	return state, nil
+}
+
+// store replaces the state file atomically by writing a temporary file and
+// renaming it over the old one.
+func (s *stateStore) store(state stateFile) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), "state-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// push adds source to the top of the stack, dropping the oldest entries
+// beyond maxStackDepth.
+func (state *stateFile) push(source savedSource) {
+	state.Stack = append(state.Stack, source)
+	if len(state.Stack) > maxStackDepth {
+		state.Stack = state.Stack[len(state.Stack)-maxStackDepth:]
+	}
+}
@@ -30,6 +30,9 @@ local function run_integration_test()
 			fnamemodify = function(path, modifier)
 				return "./im-switch"
 			end,
+			shellescape = function(str)
+				return "'" .. str:gsub("'", "'\\''") .. "'"
+			end,
 		},
 		tbl_deep_extend = function(behavior, ...)
 			local result = {}